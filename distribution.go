@@ -0,0 +1,26 @@
+package dice
+
+import (
+	"strings"
+
+	"github.com/dan-frohlich/dice/lex"
+)
+
+//Distribution computes the exact probability of each total the expression can roll.
+func Distribution(expr string) (lex.Distribution, error) {
+	p := lex.NewParser(strings.NewReader(expr))
+	ast, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return ast.Distribution(lex.Environment{})
+}
+
+//Statistics summarises the totals the expression can roll: mean, standard deviation, range, median and percentiles.
+func Statistics(expr string) (lex.Statistics, error) {
+	d, err := Distribution(expr)
+	if err != nil {
+		return lex.Statistics{}, err
+	}
+	return d.Statistics(), nil
+}
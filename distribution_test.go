@@ -0,0 +1,29 @@
+package dice
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_distribution(t *testing.T) {
+	d, err := Distribution("2d6 + 1")
+	if err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if math.Abs(d[8]-6./36) > 1e-9 || d[2] != 0 || len(d) != 11 {
+		t.Error("ERROR 2d6+1 got", d)
+	}
+	if _, err := Distribution("3@7"); err == nil {
+		t.Error("ERROR 3@7 expected error")
+	}
+}
+
+func Test_statistics(t *testing.T) {
+	stats, err := Statistics("3d6")
+	if err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if math.Abs(stats.Mean-10.5) > 1e-9 || stats.Min != 3 || stats.Max != 18 || stats.Median != 10 {
+		t.Error("ERROR 3d6 got", stats)
+	}
+}
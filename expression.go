@@ -0,0 +1,74 @@
+package dice
+
+import (
+	"strings"
+
+	"github.com/dan-frohlich/dice/lex"
+)
+
+//Expression is a dice expression compiled once to be rolled many times with any source.
+//An Expression is immutable and may be rolled by multiple goroutines at once, each with a source of its own
+//or with a source safe for concurrent use.
+type Expression struct {
+	input string
+	ast   lex.AST
+	env   lex.Environment
+}
+
+//Compile parses the expression once, to be rolled many times.
+func Compile(input string) (*Expression, error) {
+	ast, err := lex.NewParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{input: input, ast: ast}, nil
+}
+
+func (e *Expression) String() string {
+	return e.input
+}
+
+//WithVariables is the Expression resolving its `@` variables from vars.
+func (e *Expression) WithVariables(vars map[string]int) *Expression {
+	c := *e
+	c.env.Variables = vars
+	return &c
+}
+
+//WithDivision is the Expression rounding `/` as d does.
+func (e *Expression) WithDivision(d lex.Division) *Expression {
+	c := *e
+	c.env.Division = d
+	return &c
+}
+
+//WithLimits is the Expression failing with a *lex.LimitError to roll too many dice, dice of too many sides,
+//or for too long.
+func (e *Expression) WithLimits(limits lex.Limits) *Expression {
+	c := *e
+	c.env.Limits = limits
+	return &c
+}
+
+//Roll rolls the expression with the source.
+func (e *Expression) Roll(source lex.Source) (result int, plan string, err error) {
+	ev, err := e.ast.Evaluate(source, e.env)
+	if err != nil {
+		return 0, "", err
+	}
+	return ev.Total(), ev.Plan(), nil
+}
+
+//RollResult rolls the expression with the source, describing every node, operand and die of the roll.
+func (e *Expression) RollResult(source lex.Source) (*lex.RollResult, error) {
+	ev, err := e.ast.Evaluate(source, e.env)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Result(), nil
+}
+
+//Distribution computes the exact probability of each total the expression can roll.
+func (e *Expression) Distribution() (lex.Distribution, error) {
+	return e.ast.Distribution(e.env)
+}
@@ -0,0 +1,87 @@
+package dice
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/dan-frohlich/dice/lex"
+)
+
+func Test_compile(t *testing.T) {
+	tests := map[string]struct {
+		rolls    []int
+		expected int
+		plan     string
+	}{
+		"2d20kh":  {rolls: []int{7, 18}, expected: 18, plan: "((2d20 [7 18])kh [18] dropped [7])"},
+		"3d6+2":   {rolls: []int{1, 2, 3}, expected: 8, plan: "((3d6 [1 2 3])+2 [8])"},
+		"d10!>=9": {rolls: []int{9, 10, 4}, expected: 23, plan: "((1d10 [9])!(>=9) [9 10 4])"},
+	}
+	for test, expected := range tests {
+		e, err := Compile(test)
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		for i := 0; i < 3; i++ {
+			result, plan, err := e.Roll(NewScriptedSource(expected.rolls...))
+			if err != nil || result != expected.expected || plan != expected.plan {
+				t.Errorf("ERROR %v\texpected\t%d %s\tgot\t%d %s %v", test, expected.expected, expected.plan, result, plan, err)
+			}
+		}
+	}
+	if _, err := Compile("3d6)"); err == nil {
+		t.Error("ERROR 3d6) expected a parse error")
+	}
+}
+
+func Test_compile_with_roller(t *testing.T) {
+	roller := NewRoller()
+	if err := roller.Define("adv(x) = 1b(2d20)+x"); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	e, err := roller.WithVariables(map[string]int{"dex": 3}).Compile("adv(@dex)")
+	if err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if result, plan, err := e.Roll(NewScriptedSource(4, 11)); err != nil || result != 14 {
+		t.Error("ERROR adv(@dex) expected 14 got", result, plan, err)
+	}
+	if result, _, err := e.WithVariables(map[string]int{"dex": -1}).Roll(NewScriptedSource(4, 11)); err != nil || result != 10 {
+		t.Error("ERROR adv(@dex) with dex -1 expected 10 got", result, err)
+	}
+	half, err := Compile("7/2")
+	if err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if result, _, err := half.WithDivision(lex.DivideUp).Roll(CryptoSource{}); err != nil || result != 4 {
+		t.Error("ERROR 7/2 rounding up expected 4 got", result, err)
+	}
+	if d, err := half.Distribution(); err != nil || d[3] != 1 {
+		t.Error("ERROR 7/2 expected distribution {3:1} got", d, err)
+	}
+}
+
+func Test_concurrent_expression(t *testing.T) {
+	e, err := Compile("4d6kh3+d8w")
+	if err != nil {
+		t.Fatal("ERROR", err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			source := rand.New(rand.NewSource(seed))
+			for i := 0; i < 500; i++ {
+				result, err := e.RollResult(source)
+				if err != nil || result.Total < 4 {
+					t.Error("ERROR 4d6kh3+d8w rolled", result, err)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
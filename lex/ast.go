@@ -1,17 +1,17 @@
 package lex
 
 import (
-	"errors"
 	"fmt"
-	"math/rand"
+	"math"
 	"sort"
 	"strings"
 )
 
-//AST Abstract Syntax Tree
+//AST Abstract Syntax Tree. Evaluating an AST leaves it untouched, so it may be evaluated many times, and by
+//multiple goroutines at once.
 type AST interface {
-	Evaluate(*rand.Rand) (int, []int, error)
-	Plan() string
+	Evaluate(r Source, env Environment) (*Evaluation, error)
+	Distribution(env Environment) (Distribution, error)
 	String() string
 }
 
@@ -27,105 +27,390 @@ const (
 	NodeTypePrefixOperator
 	//NodeTypePostfixOperator is a unary operator.
 	NodeTypePostfixOperator
+	//NodeTypeGroup is a `,` delimited list of expressions.
+	NodeTypeGroup
+	//NodeTypeVariable is a named value bound when the AST is evaluated, such as `@str_mod`.
+	NodeTypeVariable
+	//NodeTypeFunction calls a builtin function with its operands, such as `max(1,d6-2)`.
+	NodeTypeFunction
 )
 
 type node struct {
 	kind     NodeType
 	v        int
-	vs       []int
 	operand1 *node
 	operand2 *node
+	operands []*node
 	operator string
+	check    bool
+	name     string
+	param    string
+	faces    []int
+	symbols  []Symbols
+	//offset is where the operator's token starts in the expression parsed, locating its parse errors.
+	offset int
 }
 
-//Evaluate evaluates the AST
-func (n *node) Evaluate(r *rand.Rand) (int, []int, error) {
+func (n *node) isOpenParen() bool {
+	return n.kind == NodeTypeGroup && n.operator == "("
+}
+
+//isCall is true of the open paren of a call's arguments, as in `adv(3)`.
+func (n *node) isCall() bool {
+	return n.isOpenParen() && n.name != ""
+}
+
+//Evaluate evaluates the AST in the environment env, rolling its dice with r.
+func (n *node) Evaluate(r Source, env Environment) (*Evaluation, error) {
 	if n == nil {
-		return 0, []int{}, fmt.Errorf("nill node")
+		return nil, fmt.Errorf("nill node")
+	}
+	if env.budget == nil {
+		env.budget = newBudget(env.Limits)
+	}
+	root := n.rolled(&env, env.budget)
+	if _, _, err := root.evaluate(r); err != nil {
+		return nil, err
 	}
+	return &Evaluation{root: root}, nil
+}
+
+func (n *rolled) evaluate(r Source) (int, []int, error) {
 	switch n.kind {
 	case NodeTypeLeaf:
-		return n.v, []int{n.v}, nil
+		n.vs = []int{n.v}
+		return n.v, n.vs, nil
 	case NodeTypeInfixOperator:
 		return n.evalInfix(r)
+	case NodeTypePrefixOperator:
+		return n.evalPrefix(r)
 	case NodeTypePostfixOperator:
 		return n.evalPostfix(r)
+	case NodeTypeGroup:
+		return n.evalGroup(r)
+	case NodeTypeVariable:
+		return n.evalVariable()
+	case NodeTypeFunction:
+		return n.evalFunction(r)
 	default:
 		return 0, []int{}, fmt.Errorf("unknown node type: %v", n)
 	}
 }
 
-func (n *node) evalPostfix(r *rand.Rand) (int, []int, error) {
+func (n *rolled) evalPrefix(r Source) (int, []int, error) {
+	v, _, err := n.operand1.evaluate(r)
+	if err != nil {
+		return 0, []int{}, err
+	}
+	switch {
+	case n.operator == "-":
+		var ok bool
+		if v, ok = neg(v); !ok {
+			return 0, []int{}, n.overflow()
+		}
+	case !n.isCondition():
+		return 0, []int{}, fmt.Errorf("operator not implemented: %s", n.operator)
+	}
+	//a condition evaluates to its threshold, the modifier it belongs to does the comparing
+	n.v = v
+	n.vs = []int{v}
+	return n.v, n.vs, nil
+}
+
+func (n *rolled) evalPostfix(r Source) (int, []int, error) {
 	result := 0
 	results := []int{result}
-	//right, _, err := n.operand2.Evaluate(r)
+	//right, _, err := n.operand2.evaluate(r)
 	if n.operand1 == nil {
-		n.operand1 = &node{kind: NodeTypeLeaf, v: 1, vs: []int{1}}
+		n.operand1 = (&node{kind: NodeTypeLeaf, v: 1}).rolled(n.env, n.budget)
 	}
-	left, _, err := n.operand1.Evaluate(r)
+	left, lefts, err := n.operand1.evaluate(r)
 	if err != nil {
 		return result, results, err
 	}
 	switch n.operator {
-	case "!":
-		result, results, err = n.explodingDice(r)
-	case "d%":
-		result, results, err = n.evalDice(r, left, 100)
-	case "dF":
-		_, results, err = n.evalDice(r, left, 3)
-		result = 0
-		for i, v := range results {
-			results[i] = v - 2
-			result += results[i]
-		}
+	case "kh", "kl", "dh", "dl":
+		result, results, err = n.evalKeep(r, 1, lefts)
+	case "!", "!!", "!p":
+		result, results, err = n.explodingDice(r, 0)
+	case "w":
+		result, results, err = n.wildDice(r)
 	default:
-		err = fmt.Errorf("operator not implemented: %s", n.operator)
+		if n.faces == nil {
+			err = fmt.Errorf("operator not implemented: %s", n.operator)
+			break
+		}
+		result, results, err = n.rollFaces(r, left, n.faces)
 	}
 	return result, results, err
 }
 
-func (n *node) explodingDice(r *rand.Rand) (int, []int, error) {
+//explodingDice rolls a bonus die for each die of operand1 matching the explosion condition, and for each bonus
+//die matching it in turn. `!!` compounds the bonus dice into the die which exploded, `!p` penetrates, taking one
+//from each bonus die. Without a threshold right a die explodes on its highest face.
+func (n *rolled) explodingDice(r Source, right int) (int, []int, error) {
+	die, err := n.diceType("explode")
+	if err != nil {
+		return 0, []int{}, err
+	}
+	c, err := n.explosion(die, right)
+	if err != nil {
+		return 0, []int{}, err
+	}
+	n.vs = []int{}
+	n.dice = []Die{}
+	for _, v := range n.operand1.vs {
+		rolls, err := n.explode(r, v, die, c)
+		if err != nil {
+			return 0, []int{}, err
+		}
+		if n.operator == "!p" {
+			penetrate(rolls)
+		}
+		if n.operator == "!!" {
+			total, err := n.sum(rolls)
+			if err != nil {
+				return 0, []int{}, err
+			}
+			n.vs = append(n.vs, total)
+			n.dice = append(n.dice, Die{Sides: die.sides, Value: total, Exploded: len(rolls) > 1})
+			continue
+		}
+		n.vs = append(n.vs, rolls...)
+		n.dice = append(n.dice, explodedDice(rolls, die.sides, false)...)
+	}
+	if n.v, err = n.sum(n.vs); err != nil {
+		return 0, []int{}, err
+	}
+	return n.v, n.vs, nil
+}
 
+//explosion is the condition the die explodes on, its highest face unless the threshold right is given.
+func (n *node) explosion(die dieType, right int) (condition, error) {
+	c := highestFace(die)
+	if n.kind == NodeTypeInfixOperator {
+		c = n.condition(right)
+	}
+	if c.matchesAll(die) {
+		return c, fmt.Errorf("%v - every face would explode", n)
+	}
+	return c, nil
+}
+
+//diceSource finds the dice rolled by operand1, which the action must be applied to.
+//Dice modified by rerolling, exploding, keeping or dropping keep their source.
+func (n *node) diceSource(action string) (*node, error) {
 	source := n.operand1
+	for source != nil && source.isDiceModifier() {
+		source = source.operand1
+	}
 	if source == nil {
-		return 0, []int{}, fmt.Errorf("%v - nothing to explode", n)
+		return nil, fmt.Errorf("%v - nothing to %s", n, action)
 	}
 	if source.kind == NodeTypeLeaf {
-		return 0, []int{}, fmt.Errorf("%v - can't explode a leaf node", n)
+		return nil, fmt.Errorf("%v - can't %s a leaf node", n, action)
+	}
+	if source.symbols != nil {
+		return nil, fmt.Errorf("%v - can't %s narrative dice", n, action)
+	}
+	if source.faces != nil {
+		return source, nil
 	}
 	if source.operand2 == nil {
-		return 0, []int{}, fmt.Errorf("%v - can't determine dice sides", n)
+		return nil, fmt.Errorf("%v - can't determine dice sides", n)
+	}
+	if !strings.HasPrefix(source.operator, "d") {
+		return nil, fmt.Errorf("%v - can't %s a non die expression", n, action)
+	}
+	return source, nil
+}
+
+//diceType finds the type of the dice rolled by operand1, which the action must be applied to.
+//Dice modified by rerolling, exploding, keeping or dropping keep their type.
+func (n *rolled) diceType(action string) (dieType, error) {
+	if _, err := n.diceSource(action); err != nil {
+		return dieType{}, err
 	}
-	if ! strings.HasPrefix(source.operator, "d") {
-		return 0, []int{}, fmt.Errorf("%v - can't explode a non die expression", n)
+	source := n.operand1
+	for source.isDiceModifier() {
+		source = source.operand1
 	}
-	sides := source.operand2.v
+	if source.faces != nil {
+		return facedDie(source.faces), nil
+	}
+	return numberedDie(source.operand2.v), nil
+}
+
+//maxExplosions caps the bonus dice a single die can explode into.
+const maxExplosions = 100
+
+//highestFace is the condition of a die exploding on its highest face.
+func highestFace(die dieType) condition {
+	return condition{comparator: "=", threshold: die.highest()}
+}
+
+//explode lists the rolls of a die which came up v, adding a bonus roll while the last roll matches c.
+func (n *rolled) explode(r Source, v int, die dieType, c condition) ([]int, error) {
+	rolls := []int{v}
+	for c.match(v) && len(rolls) <= maxExplosions {
+		var err error
+		if v, err = n.roll(r, die); err != nil {
+			return nil, err
+		}
+		rolls = append(rolls, v)
+	}
+	return rolls, nil
+}
+
+//roll rolls a single die within the evaluation's budget.
+func (n *rolled) roll(r Source, die dieType) (int, error) {
+	if err := n.budget.roll(1); err != nil {
+		return 0, err
+	}
+	return die.roll(r), nil
+}
+
+//penetrate takes one from each bonus roll of a penetrating die.
+func penetrate(rolls []int) {
+	for i := 1; i < len(rolls); i++ {
+		rolls[i]--
+	}
+}
+
+//explodedDice describes the rolls of a single exploding die.
+func explodedDice(rolls []int, sides int, wild bool) []Die {
+	dice := make([]Die, len(rolls))
+	for i, roll := range rolls {
+		dice[i] = Die{Sides: sides, Value: roll, Exploded: i < len(rolls)-1, Wild: wild}
+	}
+	return dice
+}
+
+const (
+	//wildDieSides is the size of the Savage Worlds wild die.
+	wildDieSides = 6
+	//targetNumber is the Savage Worlds standard target number, every 4 above it is a raise.
+	targetNumber = 4
+)
+
+//wildRoll records the rolls of a Savage Worlds trait test.
+type wildRoll struct {
+	traits    [][]int
+	wild      []int
+	snakeEyes bool
+	raises    int
+}
+
+//String labels each trait die and the wild die with its rolls, as in `trait [3] trait [8 2] wild [5]`.
+func (w *wildRoll) String() string {
+	dice := make([]string, len(w.traits))
+	for i, t := range w.traits {
+		dice[i] = fmt.Sprint("trait ", t)
+	}
+	return fmt.Sprintf("%s wild %v", strings.Join(dice, " "), w.wild)
+}
+
+func (w *wildRoll) outcome(total int) string {
+	switch {
+	case w.snakeEyes:
+		return "snake eyes"
+	case total < targetNumber:
+		return "failure"
+	case w.raises == 1:
+		return "success 1 raise"
+	case w.raises > 1:
+		return fmt.Sprintf("success %d raises", w.raises)
+	default:
+		return "success"
+	}
+}
+
+//wildSource finds the trait dice of a wild roll. They explode in the roll, so they can't already be exploding.
+func (n *node) wildSource() (*node, error) {
+	for o := n.operand1; o != nil && o.isDiceModifier(); o = o.operand1 {
+		switch o.operator {
+		case "!", "!!", "!p":
+			return nil, fmt.Errorf("%v - can't wild roll exploding dice, trait dice already explode", n)
+		}
+	}
+	return n.diceSource("wild roll")
+}
+
+//wildDice rolls a Savage Worlds trait test: each trait die and an exploding d6 wild die, keeping the highest.
+//Both coming up 1 is snake eyes, a critical failure.
+func (n *rolled) wildDice(r Source) (int, []int, error) {
+	if _, err := n.wildSource(); err != nil {
+		return 0, []int{}, err
+	}
+	die, err := n.diceType("wild roll")
+	if err != nil {
+		return 0, []int{}, err
+	}
+	c, err := n.explosion(die, 0)
+	if err != nil {
+		return 0, []int{}, err
+	}
+	wildDie := numberedDie(wildDieSides)
+	w := &wildRoll{snakeEyes: true}
 	n.vs = []int{}
+	n.dice = []Die{}
+	for _, v := range n.operand1.vs {
+		rolls, err := n.explode(r, v, die, c)
+		if err != nil {
+			return 0, []int{}, err
+		}
+		trait, err := n.sum(rolls)
+		if err != nil {
+			return 0, []int{}, err
+		}
+		w.traits = append(w.traits, rolls)
+		w.snakeEyes = w.snakeEyes && v == 1
+		n.vs = append(n.vs, trait)
+		n.dice = append(n.dice, explodedDice(rolls, die.sides, false)...)
+	}
+	v, err := n.roll(r, wildDie)
+	if err != nil {
+		return 0, []int{}, err
+	}
+	if w.wild, err = n.explode(r, v, wildDie, highestFace(wildDie)); err != nil {
+		return 0, []int{}, err
+	}
+	wild, err := n.sum(w.wild)
+	if err != nil {
+		return 0, []int{}, err
+	}
+	w.snakeEyes = w.snakeEyes && w.wild[0] == 1
+	n.vs = append(n.vs, wild)
+	n.dice = append(n.dice, explodedDice(w.wild, wildDieSides, true)...)
+
 	n.v = 0
-	for _, v := range source.vs {
-		n.vs = append(n.vs, v)
-		n.v += v
-		if v == sides {
-			roll := r.Intn(sides) + 1
-			n.v += roll
-			n.vs = append(n.vs, roll)
+	for _, v := range n.vs {
+		if v > n.v {
+			n.v = v
 		}
 	}
+	if n.v >= targetNumber && !w.snakeEyes {
+		w.raises = (n.v - targetNumber) / targetNumber
+	}
+	n.wild = w
 	return n.v, n.vs, nil
 }
 
-func (n *node) evalInfix(r *rand.Rand) (int, []int, error) {
+func (n *rolled) evalInfix(r Source) (int, []int, error) {
 	result := 0
 	results := []int{result}
-	left, _, err := n.operand1.Evaluate(r)
+	left, lefts, err := n.operand1.evaluate(r)
 
 	if err != nil {
 		return result, results, err
 	}
-	right, rights, err := n.operand2.Evaluate(r)
+	right, rights, err := n.operand2.evaluate(r)
 	if err != nil {
 		return result, results, err
 	}
+	if n.check {
+		return n.evalCheck(left, right)
+	}
 	switch n.operator {
 	case "+", "-", "*", "/":
 		result, err = n.evalMathOperators(r, left, right)
@@ -136,116 +421,371 @@ func (n *node) evalInfix(r *rand.Rand) (int, []int, error) {
 		result, results, err = n.evalBest(r, left, rights)
 	case "w":
 		result, results, err = n.evalWorst(r, left, rights)
+	case "kh", "kl", "dh", "dl":
+		result, results, err = n.evalKeep(r, right, lefts)
+	case "r", "ro":
+		result, results, err = n.evalReroll(r, right)
+	case "!", "!!", "!p":
+		result, results, err = n.explodingDice(r, right)
+	case "<", "<=", ">", ">=", "=":
+		result, results, err = n.evalSuccesses(r, right)
+	case "f":
+		result, results, err = n.evalFailures(r, right)
+	case "&&", "||":
+		result, results, err = n.evalLogic()
 	default:
 		err = fmt.Errorf("unhandled operator: %v", n.operator)
 	}
 	return result, results, err
 }
 
-func (n *node) evalBest(r *rand.Rand, left int, rights []int) (int, []int, error) {
-	if left > len(rights) {
+//evalGroup sums the members of the group, each member's total is one of the results.
+func (n *rolled) evalGroup(r Source) (int, []int, error) {
+	n.vs = make([]int, len(n.operands))
+	for i, o := range n.operands {
+		v, _, err := o.evaluate(r)
+		if err != nil {
+			return 0, []int{}, err
+		}
+		n.vs[i] = v
+	}
+	var err error
+	if n.v, err = n.sum(n.vs); err != nil {
+		return 0, []int{}, err
+	}
+	return n.v, n.vs, nil
+}
+
+func (n *rolled) evalBest(r Source, left int, rights []int) (int, []int, error) {
+	if left < 0 || left > len(rights) {
 		return 0, []int{}, fmt.Errorf("%v can't gather %d best items from a slice of %d items", n, left, len(rights))
 	}
-	s := make([]int, len(rights))
-	for i, v := range rights {
-		s[i] = v
+	picks := sortedIndexes(rights)
+	return n.pick(rights, picks[len(picks)-left:])
+}
+
+func (n *rolled) evalWorst(r Source, left int, rights []int) (int, []int, error) {
+	if left < 0 || left > len(rights) {
+		return 0, []int{}, fmt.Errorf("%v can't gather %d worst items from a slice of %d items", n, left, len(rights))
 	}
-	sort.Ints(s)
-	n.v = 0
-	n.vs = s[len(s)-left:]
-	if len(n.vs) != left {
-		return 0, nil, errors.New("FOOBAR")
+	picks := sortedIndexes(rights)
+	return n.pick(rights, picks[:left])
+}
+
+//evalKeep applies the keep highest, keep lowest, drop highest and drop lowest modifiers to the count of values.
+func (n *rolled) evalKeep(r Source, count int, values []int) (int, []int, error) {
+	switch n.operator {
+	case "kh":
+		return n.evalBest(r, count, values)
+	case "kl":
+		return n.evalWorst(r, count, values)
 	}
-	for _, v := range n.vs {
-		n.v += v
+	if count < 0 || count > len(values) {
+		return 0, []int{}, fmt.Errorf("%v can't drop %d items from a slice of %d items", n, count, len(values))
 	}
-	return n.v, n.vs, nil
+	if n.operator == "dh" {
+		return n.evalWorst(r, len(values)-count, values)
+	}
+	return n.evalBest(r, len(values)-count, values)
 }
 
-func (n *node) evalWorst(r *rand.Rand, left int, rights []int) (int, []int, error) {
-	if left > len(rights) {
-		return 0, []int{}, fmt.Errorf("%v can't gather %d worst items from a slice of %d items", n, left, len(rights))
+//selectionSource is the operand a best, worst, keep or drop operator selects from.
+func (n *node) selectionSource() *node {
+	if n.operator == "b" || n.operator == "w" {
+		return n.operand2
 	}
-	s := make([]int, len(rights))
-	n.v = 0
-	for i, v := range rights {
-		s[i] = v
+	return n.operand1
+}
+
+//selectionSource is the evaluated operand a best, worst, keep or drop operator selected from.
+func (n *rolled) selectionSource() *rolled {
+	if n.operator == "b" || n.operator == "w" {
+		return n.operand2
+	}
+	return n.operand1
+}
+
+//isSelection is true of best, worst, keep and drop operators.
+func (n *node) isSelection() bool {
+	switch n.operator {
+	case "b", "w":
+		return n.kind == NodeTypeInfixOperator
+	case "kh", "kl", "dh", "dl":
+		return true
+	}
+	return false
+}
+
+//pick keeps the items of rights found at the picks indexes.
+//When rights are the dice rolled by the selection source the dice which were not picked are dropped.
+func (n *rolled) pick(rights []int, picks []int) (int, []int, error) {
+	n.vs = make([]int, len(picks))
+	n.picks = picks
+	for i, p := range picks {
+		n.vs[i] = rights[p]
 	}
-	sort.Ints(s)
-	n.vs = s[:left]
-	// fmt.Println(rights)
-	// fmt.Println(n.vs)
-	for i, v := range n.vs {
-		s[i] = v
-		n.v += v
+	var err error
+	if n.v, err = n.sum(n.vs); err != nil {
+		return 0, []int{}, err
+	}
+
+	n.dice = nil
+	source := n.selectionSource()
+	candidates := source.counted()
+	if len(candidates) == len(rights) {
+		n.dice = make([]Die, len(source.dice))
+		copy(n.dice, source.dice)
+		for _, c := range candidates {
+			n.dice[c].Dropped = true
+		}
+		for _, p := range picks {
+			n.dice[candidates[p]].Dropped = false
+		}
 	}
 	return n.v, n.vs, nil
 }
 
-func (n *node) evalDice(r *rand.Rand, left int, right int) (int, []int, error) {
-	acc := 0
-	results := make([]int, left)
-	for i := 0; i < left; i++ {
-		results[i] = r.Intn(right) + 1
-		acc += results[i]
+//counted lists the indexes of the node's dice which count towards its values.
+func (n *rolled) counted() []int {
+	return countedDice(n.dice)
+}
+
+//countedDice lists the indexes of the dice which were not dropped or rerolled.
+func countedDice(dice []Die) []int {
+	var indexes []int
+	for i, d := range dice {
+		if !d.Dropped && !d.Rerolled {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+//sortedIndexes lists the indexes of values ordered from lowest to highest value.
+func sortedIndexes(values []int) []int {
+	indexes := make([]int, len(values))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return values[indexes[i]] < values[indexes[j]]
+	})
+	return indexes
+}
+
+func (n *rolled) evalDice(r Source, left int, right int) (int, []int, error) {
+	if right < 1 {
+		return 0, []int{}, fmt.Errorf("%v - can't roll a %d sided die", n, right)
+	}
+	if err := n.env.Limits.checkSides(right); err != nil {
+		return 0, []int{}, err
+	}
+	return n.rollSides(r, left, right, func(side int) int { return side + 1 })
+}
+
+//rollFaces rolls count dice, each showing any of faces with equal probability.
+func (n *rolled) rollFaces(r Source, count int, faces []int) (int, []int, error) {
+	return n.rollSides(r, count, len(faces), func(side int) int { return faces[side] })
+}
+
+//rollSides rolls count dice of sides sides, each showing the face of the side rolled. Numbered dice don't list
+//their faces, however many sides they have. The dice of a narrative die operator show the symbols of their faces.
+func (n *rolled) rollSides(r Source, count int, sides int, face func(side int) int) (int, []int, error) {
+	if count < 0 {
+		return 0, []int{}, fmt.Errorf("%v - can't roll %d dice", n, count)
+	}
+	if err := n.budget.roll(count); err != nil {
+		return 0, []int{}, err
+	}
+	//the dice are appended one by one, so an evaluation out of time stops before allocating for every die
+	results := []int{}
+	n.dice = []Die{}
+	for i := 0; i < count; i++ {
+		if err := n.budget.timeout(); err != nil {
+			return 0, []int{}, err
+		}
+		side := r.Intn(sides)
+		die := Die{Sides: sides, Value: face(side)}
+		if n.symbols != nil {
+			die.Symbols = n.symbols[side]
+		}
+		results = append(results, die.Value)
+		n.dice = append(n.dice, die)
+	}
+	acc, err := n.sum(results)
+	if err != nil {
+		return 0, []int{}, err
 	}
 	n.v = acc
 	n.vs = results
-	// fmt.Println(n.vs)
 	return acc, results, nil
 }
 
-func (n *node) evalMathOperators(r *rand.Rand, left int, right int) (int, error) {
+func (n *rolled) evalMathOperators(r Source, left int, right int) (int, error) {
+	result, err := n.arithmetic(left, right, n.env.Division)
+	n.v = result
+	n.vs = []int{result}
+	return n.v, err
+}
+
+//arithmetic applies the node's math operator to left and right, rounding quotients as division does.
+func (n *node) arithmetic(left int, right int, division Division) (int, error) {
 	var result int
 	var err error
+	ok := true
 	switch n.operator {
 	case "+":
-		result = left + right
+		result, ok = add(left, right)
 	case "-":
-		result = left - right
+		result, ok = sub(left, right)
 	case "*":
-		result = left * right
+		result, ok = mul(left, right)
 	case "/":
-		if right == 0 {
+		switch {
+		case right == 0:
 			err = fmt.Errorf("divide by zero in %v", n)
-		} else {
-			result = left / right
+		case left == math.MinInt && right == -1:
+			ok = false
+		default:
+			result = divisions[division](left, right)
 		}
 	default:
 		err = fmt.Errorf("unhandled operator: %v", n.operator)
 	}
-	n.v = result
-	n.vs = []int{result}
-	return n.v, err
+	if !ok {
+		return 0, n.overflow()
+	}
+	return result, err
 }
+
 func (n *node) String() string {
 	if n == nil {
 		return "<nil>"
 	}
 	switch n.kind {
 	case NodeTypeLeaf:
+		if n.param != "" {
+			return n.param
+		}
 		return fmt.Sprintf("%d", n.v)
+	case NodeTypePrefixOperator:
+		return fmt.Sprintf("(%s%v)", n.operator, n.operand1)
 	case NodeTypePostfixOperator:
 		return fmt.Sprintf("(%v%s)", n.operand1, n.operator)
 	case NodeTypeInfixOperator:
+		if n.check {
+			return fmt.Sprintf("(%v %s %v)", n.operand1, n.operator, n.operand2)
+		}
+		if n.isSuccessCount() {
+			return fmt.Sprintf("(%v#%s%v)", n.operand1, n.operator, n.operand2)
+		}
 		return fmt.Sprintf("(%v%s%v)", n.operand1, n.operator, n.operand2)
+	case NodeTypeGroup:
+		s := make([]string, len(n.operands))
+		for i, o := range n.operands {
+			s[i] = o.String()
+		}
+		return fmt.Sprintf("(%s)", strings.Join(s, ","))
+	case NodeTypeVariable:
+		return "@" + n.name
+	case NodeTypeFunction:
+		s := make([]string, len(n.operands))
+		for i, o := range n.operands {
+			s[i] = o.String()
+		}
+		return fmt.Sprintf("%s(%s)", n.operator, strings.Join(s, ","))
 	default:
 		return fmt.Sprintf("[unhandled node type: %v]", n.kind)
 	}
 }
 
-func (n *node) Plan() string {
+func (n *rolled) Plan() string {
 	if n == nil {
 		return "<nil>"
 	}
 	switch n.kind {
 	case NodeTypeLeaf:
 		return fmt.Sprintf("%d", n.v)
+	case NodeTypePrefixOperator:
+		return fmt.Sprintf("(%s%v)", n.operator, n.operand1.Plan())
 	case NodeTypePostfixOperator:
-		return fmt.Sprintf("(%v%s %v)", n.operand1.Plan(), n.operator, n.vs)
+		if n.wild != nil {
+			return fmt.Sprintf("(%v%s %v %s)", n.operand1.Plan(), n.operator, n.wild, n.wild.outcome(n.v))
+		}
+		return fmt.Sprintf("(%v%s %s)", n.operand1.Plan(), n.operator, n.planOfValues())
 	case NodeTypeInfixOperator:
-		return fmt.Sprintf("(%v%s%v %v)", n.operand1.Plan(), n.operator, n.operand2.Plan(), n.vs)
+		if n.check {
+			return fmt.Sprintf("(%v %s %v %s)", n.operand1.Plan(), n.operator, n.operand2.Plan(), n.planOfCheck())
+		}
+		if n.isSuccessCount() {
+			return fmt.Sprintf("(%v#%s%v %s)", n.operand1.Plan(), n.operator, n.operand2.Plan(), n.planOfValues())
+		}
+		return fmt.Sprintf("(%v%s%v %s)", n.operand1.Plan(), n.operator, n.operand2.Plan(), n.planOfValues())
+	case NodeTypeGroup:
+		return fmt.Sprintf("(%s)", n.planOf(nil))
+	case NodeTypeVariable:
+		return fmt.Sprintf("@%s [%d]", n.name, n.v)
+	case NodeTypeFunction:
+		return n.planOfFunction()
 	default:
 		return fmt.Sprintf("[unhandled node type: %v]", n.kind)
 	}
 }
+
+//planOfValues plans the node's values, naming the dice or group members dropped by a selection.
+func (n *rolled) planOfValues() string {
+	if n.isCheck() {
+		return n.planOfCheck()
+	}
+	if n.symbols != nil {
+		return n.planOfSymbols()
+	}
+	if s, ok := n.tally(); ok && n.operator == "+" {
+		return fmt.Sprintf("%v %v", n.vs, s.Cancel())
+	}
+	if n.isSuccessCount() || n.operator == "f" {
+		return n.planOfCounts()
+	}
+	if n.operator == "r" || n.operator == "ro" {
+		var rerolled []int
+		for _, d := range n.dice {
+			if d.Rerolled {
+				rerolled = append(rerolled, d.Value)
+			}
+		}
+		if len(rerolled) > 0 {
+			return fmt.Sprintf("%v rerolled %v", n.vs, rerolled)
+		}
+	}
+	if !n.isSelection() {
+		return fmt.Sprint(n.vs)
+	}
+	if source := n.selectionSource(); source.kind == NodeTypeGroup {
+		return fmt.Sprintf("[%s]", source.planOf(n.picks))
+	}
+	var dropped []int
+	for _, d := range n.dice {
+		if d.Dropped {
+			dropped = append(dropped, d.Value)
+		}
+	}
+	if len(dropped) == 0 {
+		return fmt.Sprint(n.vs)
+	}
+	return fmt.Sprintf("%v dropped %v", n.vs, dropped)
+}
+
+//planOf plans the group members found at the picks indexes, or every member when picks is nil.
+func (n *rolled) planOf(picks []int) string {
+	if picks == nil {
+		picks = make([]int, len(n.operands))
+		for i := range picks {
+			picks[i] = i
+		}
+	}
+	s := make([]string, len(picks))
+	for i, p := range picks {
+		s[i] = fmt.Sprintf("%d : %s", n.vs[p], n.operands[p].Plan())
+	}
+	return strings.Join(s, " , ")
+}
@@ -80,30 +80,82 @@ func (r diceASTExpectedResult) Equal(other anyASTResult) bool {
 
 func Test_ast(t *testing.T) {
 	tests := astTestCases{
-		"":       simpleASTResult{z: []int{}, e: errors.New("nill node")},
-		"!":      simpleASTResult{e: errors.New("(1!) - can't explode a leaf node")},
-		"1wd%":   diceASTExpectedResult{min: 1, max: 100},
-		"1":      simpleASTResult{v: 1},
-		"1+3":    simpleASTResult{v: 4},
-		"1*3":    simpleASTResult{v: 3},
-		"1w2d20": diceASTExpectedResult{min: 1, max: 20},
-		"1w3d6":  diceASTExpectedResult{min: 1, max: 6},
-		"2b3d6":  diceASTExpectedResult{min: 2, max: 12},
-		"2d6+12": diceASTExpectedResult{min: 14, max: 24},
-		"2d6!":   simpleASTResult{v: 13, z: []int{1, 6, 6}},
-		"2d%":    diceASTExpectedResult{min: 2, max: 200},
-		"3!":     simpleASTResult{e: errors.New("(3!) - can't explode a leaf node")},
-		"3b4d6":  simpleASTResult{v: 17, z: []int{5, 6, 6}},
-		"3d6":    diceASTExpectedResult{min: 3, max: 18},
-		"4/2":    simpleASTResult{v: 2},
-		"4b2d6":  diceASTExpectedResult{e: errors.New("(4b(2d6)) can't gather 4 best items from a slice of 2 items")},
-		"4b3d10": diceASTExpectedResult{e: errors.New("(4b(3d10)) can't gather 4 best items from a slice of 3 items")},
-		"5d6":    diceASTExpectedResult{min: 5, max: 30},
-		"d%":     diceASTExpectedResult{min: 1, max: 100},
+		"":                 simpleASTResult{z: []int{}, e: errors.New("nill node")},
+		"!":                simpleASTResult{e: errors.New("(1!) - can't explode a leaf node")},
+		"d1w":              simpleASTResult{e: errors.New("((1d1)w) - every face would explode")},
+		"d{5}w":            simpleASTResult{e: errors.New("((1d{5})w) - every face would explode")},
+		"d4!kh1w":          simpleASTResult{e: errors.New("((((1d4)!)kh1)w) - can't wild roll exploding dice, trait dice already explode")},
+		"1wd%":             diceASTExpectedResult{min: 1, max: 100},
+		"(3,5)":            simpleASTResult{v: 8},
+		"1b(3,5)":          simpleASTResult{v: 5},
+		"1w(3,5,1+1)":      simpleASTResult{v: 2},
+		"2b(1,3,2)":        simpleASTResult{v: 5},
+		"3b(1,2)":          simpleASTResult{e: errors.New("(3b(1,2)) can't gather 3 best items from a slice of 2 items")},
+		"1b(d6,d8)":        diceASTExpectedResult{min: 1, max: 8},
+		"2w(d10,d12,d4+1)": diceASTExpectedResult{min: 2, max: 15},
+		"1":                simpleASTResult{v: 1},
+		"@str_mod":         simpleASTResult{e: errors.New("unbound variable @str_mod")},
+		"-2+3":             simpleASTResult{v: 1},
+		"2*-3":             simpleASTResult{v: -6},
+		"-(1d4)":           diceASTExpectedResult{min: -4, max: -1},
+		"-2+d6":            diceASTExpectedResult{min: -1, max: 4},
+		"(-2)d6":           simpleASTResult{e: errors.New("((-2)d6) - can't roll -2 dice")},
+		"d-6":              simpleASTResult{e: errors.New("(1d(-6)) - can't roll a -6 sided die")},
+		"1+3":              simpleASTResult{v: 4},
+		"1*3":              simpleASTResult{v: 3},
+		"1w2d20":           diceASTExpectedResult{min: 1, max: 20},
+		"1w3d6":            diceASTExpectedResult{min: 1, max: 6},
+		"2b3d6":            diceASTExpectedResult{min: 2, max: 12},
+		"2d6+12":           diceASTExpectedResult{min: 14, max: 24},
+		"2d6!":             simpleASTResult{v: 18, z: []int{1, 6, 6, 5}},
+		"2d6!!":            simpleASTResult{v: 18, z: []int{1, 17}},
+		"2d6!p":            simpleASTResult{v: 16, z: []int{1, 6, 5, 4}},
+		"2d6!>=5":          simpleASTResult{v: 21, z: []int{1, 6, 6, 5, 3}},
+		"2d6!<7":           simpleASTResult{e: errors.New("((2d6)!(<7)) - every face would explode")},
+		"d1!":              simpleASTResult{e: errors.New("((1d1)!) - every face would explode")},
+		"2d%":              diceASTExpectedResult{min: 2, max: 200},
+		"3!":               simpleASTResult{e: errors.New("(3!) - can't explode a leaf node")},
+		"3b4d6":            simpleASTResult{v: 17, z: []int{5, 6, 6}},
+		"3d6":              diceASTExpectedResult{min: 3, max: 18},
+		"4/2":              simpleASTResult{v: 2},
+		"4b2d6":            diceASTExpectedResult{e: errors.New("(4b(2d6)) can't gather 4 best items from a slice of 2 items")},
+		"4b3d10":           diceASTExpectedResult{e: errors.New("(4b(3d10)) can't gather 4 best items from a slice of 3 items")},
+		"5d6":              diceASTExpectedResult{min: 5, max: 30},
+		"d%":               diceASTExpectedResult{min: 1, max: 100},
 	}
 	runASTTestCases(tests, t)
 }
 
+func Test_wild_die(t *testing.T) {
+	snakeEyes := 0
+	for seed := int64(0); seed < 1000; seed++ {
+		ast, err := NewParser(strings.NewReader("d4w")).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := ast.Evaluate(rand.New(rand.NewSource(seed)), Environment{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, z, w := e.Total(), e.Values(), e.root.wild
+		if len(z) != 2 || v != z[0] && v != z[1] || v < z[0] || v < z[1] {
+			t.Errorf("ERROR seed %d: %d is not the highest of trait and wild die %v", seed, v, z)
+		}
+		if w.snakeEyes {
+			snakeEyes++
+			if w.traits[0][0] != 1 || w.wild[0] != 1 || w.raises != 0 {
+				t.Errorf("ERROR seed %d: snake eyes on %v", seed, e.Plan())
+			}
+		} else if v >= 4 && w.raises != (v-4)/4 {
+			t.Errorf("ERROR seed %d: %d raises on %v", seed, w.raises, e.Plan())
+		}
+	}
+	if snakeEyes == 0 {
+		t.Error("ERROR no snake eyes in 1000 rolls")
+	}
+	t.Logf("OK %d snake eyes in 1000 rolls", snakeEyes)
+}
+
 func runASTTestCases(tests astTestCases, t *testing.T) {
 
 	size := len(tests)
@@ -131,8 +183,12 @@ func runASTTestCase(test string, expected anyASTResult, t *testing.T) {
 	if !ok {
 		t.Errorf("ERROR %s : result %v (%T) is not type %T", test, ast, ast, &node{})
 	}
-	v, z, e := n.Evaluate(rand.New(rand.NewSource(11)))
-	actual := simpleASTResult{v: v, z: z, e: e}
+	actual := simpleASTResult{}
+	if evaluation, e := n.Evaluate(rand.New(rand.NewSource(11)), Environment{}); e != nil {
+		actual.e = e
+	} else {
+		actual.v, actual.z = evaluation.Total(), evaluation.Values()
+	}
 
 	if !expected.Equal(actual) {
 		t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, actual)
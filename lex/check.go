@@ -0,0 +1,106 @@
+package lex
+
+import "fmt"
+
+//isCheck is true of comparisons, such as `d20+5 >= 15`, and of their `&&` and `||` combinations.
+func (n *node) isCheck() bool {
+	if n == nil || n.kind != NodeTypeInfixOperator {
+		return false
+	}
+	return n.check || n.operator == "&&" || n.operator == "||"
+}
+
+//isPool is true of several dice rolled together, as the `8d10` of `8d10>=7`. A comparator directly on a pool could
+//count its successes or check its total, so it must be marked by `#` or the pool put in parentheses.
+func (n *node) isPool() bool {
+	dice := n.kind == NodeTypeInfixOperator && n.operator == "d" || n.kind == NodeTypePostfixOperator && n.faces != nil
+	if !dice {
+		return false
+	}
+	return n.operand1.kind != NodeTypeLeaf || n.operand1.v != 1
+}
+
+//checkMargin is how far the total left is past the closest total passing the comparison with right.
+//The margin is negative when the check fails.
+func (n *node) checkMargin(left int, right int) int {
+	switch n.operator {
+	case ">=":
+		return left - right
+	case ">":
+		return left - right - 1
+	case "<=":
+		return right - left
+	case "<":
+		return right - left - 1
+	}
+	if left > right {
+		return right - left
+	}
+	return left - right
+}
+
+//logicMargin combines the margins of two checks, `&&` passes with the weaker margin and `||` with the stronger.
+func (n *node) logicMargin(left int, right int) int {
+	if (n.operator == "&&") == (left < right) {
+		return left
+	}
+	return right
+}
+
+//evalCheck compares the totals left and right. A check totals 1 when it passes and 0 when it fails.
+func (n *rolled) evalCheck(left int, right int) (int, []int, error) {
+	n.margin = n.checkMargin(left, right)
+	return n.passed()
+}
+
+//evalLogic combines the checks of both operands.
+func (n *rolled) evalLogic() (int, []int, error) {
+	if !n.operand1.isCheck() || !n.operand2.isCheck() {
+		return 0, []int{}, fmt.Errorf("%v - %s can only combine checks", n, n.operator)
+	}
+	n.margin = n.logicMargin(n.operand1.margin, n.operand2.margin)
+	return n.passed()
+}
+
+func (n *rolled) passed() (int, []int, error) {
+	n.v = 0
+	if n.margin >= 0 {
+		n.v = 1
+	}
+	n.vs = []int{n.v}
+	return n.v, n.vs, nil
+}
+
+//checkDistribution is the distribution of a check passing, 1, or failing, 0.
+func (n *node) checkDistribution(env Environment) (Distribution, error) {
+	if !n.check && (!n.operand1.isCheck() || !n.operand2.isCheck()) {
+		return nil, fmt.Errorf("%v - %s can only combine checks", n, n.operator)
+	}
+	left, err := n.operand1.Distribution(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.operand2.Distribution(env)
+	if err != nil {
+		return nil, err
+	}
+	return combine(env, left, right, func(x, y int) (int, error) {
+		margin := n.checkMargin(x, y)
+		if !n.check {
+			//a passed check totals 1, which is a margin of 0 for both operands
+			margin = n.logicMargin(x-1, y-1)
+		}
+		if margin >= 0 {
+			return 1, nil
+		}
+		return 0, nil
+	})
+}
+
+//planOfCheck plans whether the check passed and by what margin.
+func (n *rolled) planOfCheck() string {
+	if n.v == 1 {
+		return fmt.Sprintf("pass %+d", n.margin)
+	}
+	return fmt.Sprintf("fail %+d", n.margin)
+}
@@ -0,0 +1,702 @@
+package lex
+
+import (
+	"fmt"
+	"sort"
+)
+
+//Distribution is the exact probability mass function of an AST, the probability of each possible total.
+type Distribution map[int]float64
+
+//explosionTolerance is the chance of exploding again below which an exploding die's distribution stops growing.
+const explosionTolerance = 1e-15
+
+//maxGroupOutcomes limits the joint outcomes enumerated to select the best or worst of a group.
+const maxGroupOutcomes = 1 << 20
+
+//Outcomes lists the possible totals from lowest to highest.
+func (d Distribution) Outcomes() []int {
+	outcomes := make([]int, 0, len(d))
+	for v := range d {
+		outcomes = append(outcomes, v)
+	}
+	sort.Ints(outcomes)
+	return outcomes
+}
+
+//Distribution computes the probability of each total the AST can evaluate to in the environment env, without
+//rolling any dice.
+func (n *node) Distribution(env Environment) (Distribution, error) {
+	if n == nil {
+		return nil, fmt.Errorf("nill node")
+	}
+	if env.budget == nil {
+		env.budget = newBudget(env.Limits)
+	}
+	if err := env.timeout(); err != nil {
+		return nil, err
+	}
+	d, err := n.distribution(env)
+	if err == ErrOverflow {
+		//the distributions summing outcomes report a bare ErrOverflow, which is this node overflowing
+		return nil, n.overflow()
+	}
+	return d, err
+}
+
+func (n *node) distribution(env Environment) (Distribution, error) {
+	switch n.kind {
+	case NodeTypeLeaf:
+		return Distribution{n.v: 1}, nil
+	case NodeTypeInfixOperator:
+		return n.infixDistribution(env)
+	case NodeTypePrefixOperator:
+		return n.prefixDistribution(env)
+	case NodeTypePostfixOperator:
+		return n.postfixDistribution(env)
+	case NodeTypeGroup:
+		d := Distribution{0: 1}
+		for _, o := range n.operands {
+			od, err := o.Distribution(env)
+			if err != nil {
+				return nil, err
+			}
+			if d, err = convolve(env, d, od); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case NodeTypeVariable:
+		return n.variableDistribution(env)
+	case NodeTypeFunction:
+		return n.functionDistribution(env)
+	default:
+		return nil, fmt.Errorf("unknown node type: %v", n)
+	}
+}
+
+func (n *node) prefixDistribution(env Environment) (Distribution, error) {
+	if n.operator != "-" && !n.isCondition() {
+		return nil, fmt.Errorf("%v - distribution of %s not supported", n, n.operator)
+	}
+	d, err := n.operand1.Distribution(env)
+	if err != nil || n.operator != "-" {
+		return d, err
+	}
+	negated := Distribution{}
+	for v, p := range d {
+		nv, ok := neg(v)
+		if !ok {
+			return nil, ErrOverflow
+		}
+		negated[nv] = p
+	}
+	return negated, nil
+}
+
+func (n *node) infixDistribution(env Environment) (Distribution, error) {
+	if n.isCheck() {
+		return n.checkDistribution(env)
+	}
+	switch n.operator {
+	case "+", "-", "*", "/":
+		left, err := n.operand1.Distribution(env)
+		if err != nil {
+			return nil, err
+		}
+		right, err := n.operand2.Distribution(env)
+		if err != nil {
+			return nil, err
+		}
+		return combine(env, left, right, func(x, y int) (int, error) {
+			return n.arithmetic(x, y, env.Division)
+		})
+	case "d", "r", "ro", "!", "!!", "!p":
+		return n.diceDistribution(env, sumsOfDice(env))
+	case "b", "w", "kh", "kl", "dh", "dl":
+		return n.selectionDistribution(env)
+	case "<", "<=", ">", ">=", "=", "f":
+		return n.countDistribution(env)
+	default:
+		return nil, fmt.Errorf("%v - distribution of %s not supported", n, n.operator)
+	}
+}
+
+//countDistribution is the distribution of the successes, less any failures, counted by this node.
+func (n *node) countDistribution(env Environment) (Distribution, error) {
+	success := n
+	var failure *condition
+	if n.operator == "f" {
+		if !n.operand1.isSuccessCount() {
+			return nil, fmt.Errorf("%v - can't count failures without counting successes", n)
+		}
+		threshold, err := n.operand2.constant(env)
+		if err != nil {
+			return nil, err
+		}
+		c := n.condition(threshold)
+		failure = &c
+		success = n.operand1
+	}
+	if _, err := success.diceSource("count successes of"); err != nil {
+		return nil, err
+	}
+	threshold, err := success.operand2.constant(env)
+	if err != nil {
+		return nil, err
+	}
+	c := condition{comparator: success.operator, threshold: threshold}
+	score := func(f int) int {
+		v := 0
+		if c.match(f) {
+			v++
+		}
+		if failure != nil && failure.match(f) {
+			v--
+		}
+		return v
+	}
+	sums := sumsOfDice(env)
+	dice := success.operand1
+	switch {
+	case (dice.operator == "!" || dice.operator == "!p") && !dice.operand1.explodesApart():
+		//each bonus die is counted, so the score of a die is the score of every roll it explodes into
+		return dice.explodedDistribution(env, sums, score)
+	case dice.explodesApart():
+		return nil, fmt.Errorf("%v - distribution of a count of modified exploding dice not supported", n)
+	}
+	return dice.diceDistribution(env, func(count int, faces []int, die Distribution) (Distribution, error) {
+		scored := Distribution{}
+		for f, p := range die {
+			scored[score(f)] += p
+		}
+		return sums(count, faces, scored)
+	})
+}
+
+//constant is the single value a condition's threshold can take.
+func (n *node) constant(env Environment) (int, error) {
+	d, err := n.Distribution(env)
+	if err != nil {
+		return 0, err
+	}
+	if len(d) != 1 {
+		return 0, fmt.Errorf("%v - distribution of a variable condition not supported", n)
+	}
+	return d.Outcomes()[0], nil
+}
+
+func (n *node) postfixDistribution(env Environment) (Distribution, error) {
+	switch n.operator {
+	case "!", "!!", "!p":
+		return n.diceDistribution(env, sumsOfDice(env))
+	case "kh", "kl", "dh", "dl":
+		return n.selectionDistribution(env)
+	case "w":
+		if _, err := n.wildSource(); err != nil {
+			return nil, err
+		}
+		wildFaces := dieFaces(wildDieSides)
+		wild, err := explodedDie(env, uniform(wildFaces), wildFaces, highestFace(facedDie(wildFaces)), false, identity)
+		if err != nil {
+			return nil, err
+		}
+		return n.operand1.diceDistribution(env, func(count int, faces []int, die Distribution) (Distribution, error) {
+			c, err := n.explosion(facedDie(faces), 0)
+			if err != nil {
+				return nil, err
+			}
+			trait, err := explodedDie(env, die, faces, c, false, identity)
+			if err != nil {
+				return nil, err
+			}
+			d := wild
+			for i := 0; i < count; i++ {
+				if d, err = maximum(env, d, trait); err != nil {
+					return nil, err
+				}
+			}
+			return d, nil
+		})
+	default:
+		if n.faces != nil {
+			return n.diceDistribution(env, sumsOfDice(env))
+		}
+		return nil, fmt.Errorf("%v - distribution of %s not supported", n, n.operator)
+	}
+}
+
+//diceFn builds a distribution from the count of dice rolled, their faces and the distribution of a single die.
+type diceFn func(count int, faces []int, die Distribution) (Distribution, error)
+
+//diceDistribution mixes the distributions built by fn for each count and faces of the dice this node may roll.
+//Rerolling and exploding modify the distribution of a single die of the dice they are applied to.
+func (n *node) diceDistribution(env Environment, fn diceFn) (Distribution, error) {
+	switch n.operator {
+	case "r", "ro":
+		if _, err := n.diceSource("reroll"); err != nil {
+			return nil, err
+		}
+		threshold, err := n.operand2.constant(env)
+		if err != nil {
+			return nil, err
+		}
+		if n.operand1.explodesApart() {
+			return nil, fmt.Errorf("%v - distribution of rerolled exploding dice not supported", n)
+		}
+		c := n.condition(threshold)
+		return n.operand1.diceDistribution(env, func(count int, faces []int, die Distribution) (Distribution, error) {
+			if n.operator == "r" && c.matchesAll(facedDie(faces)) {
+				return nil, fmt.Errorf("%v - every face would be rerolled", n)
+			}
+			return fn(count, faces, rerolledDie(die, faces, c, n.operator == "ro"))
+		})
+	case "!", "!!", "!p":
+		return n.explodedDistribution(env, fn, identity)
+	}
+
+	counts, err := n.operand1.Distribution(env)
+	if err != nil {
+		return nil, err
+	}
+	var sides Distribution
+	switch {
+	case n.kind == NodeTypeInfixOperator && n.operator == "d":
+		if sides, err = n.operand2.Distribution(env); err != nil {
+			return nil, err
+		}
+	case n.kind == NodeTypePostfixOperator && n.faces != nil:
+		sides = Distribution{len(n.faces): 1}
+	default:
+		return nil, fmt.Errorf("%v - distribution of a non die expression not supported", n)
+	}
+
+	//counts are visited from fewest to most, so fn may build on the dice it summed for the last count
+	d := Distribution{}
+	for _, count := range counts.Outcomes() {
+		pc := counts[count]
+		if count < 0 {
+			return nil, fmt.Errorf("%v - can't roll %d dice", n, count)
+		}
+		if err := env.Limits.checkDice(count); err != nil {
+			return nil, err
+		}
+		for s, ps := range sides {
+			faces := n.faces
+			if faces == nil {
+				if s < 1 {
+					return nil, fmt.Errorf("%v - can't roll a %d sided die", n, s)
+				}
+				if err := env.Limits.checkSides(s); err != nil {
+					return nil, err
+				}
+				faces = dieFaces(s)
+			}
+			dd, err := fn(count, faces, uniform(faces))
+			if err != nil {
+				return nil, err
+			}
+			for v, p := range dd {
+				d[v] += pc * ps * p
+			}
+		}
+	}
+	return d, nil
+}
+
+//explodedDistribution mixes the distributions built by fn from the exploding dice of this node, each die adding up
+//the score of every roll it explodes into.
+func (n *node) explodedDistribution(env Environment, fn diceFn, score func(f int) int) (Distribution, error) {
+	if _, err := n.diceSource("explode"); err != nil {
+		return nil, err
+	}
+	if n.operand1.explodesApart() {
+		return nil, fmt.Errorf("%v - distribution of dice exploding twice not supported", n)
+	}
+	threshold := 0
+	if n.kind == NodeTypeInfixOperator {
+		var err error
+		if threshold, err = n.operand2.constant(env); err != nil {
+			return nil, err
+		}
+	}
+	return n.operand1.diceDistribution(env, func(count int, faces []int, die Distribution) (Distribution, error) {
+		c, err := n.explosion(facedDie(faces), threshold)
+		if err != nil {
+			return nil, err
+		}
+		exploded, err := explodedDie(env, die, faces, c, n.operator == "!p", score)
+		if err != nil {
+			return nil, err
+		}
+		return fn(count, faces, exploded)
+	})
+}
+
+//selectionDistribution is the distribution of the best, worst, kept or remaining values of the selection source.
+func (n *node) selectionDistribution(env Environment) (Distribution, error) {
+	best := n.operator == "b" || n.operator == "kh" || n.operator == "dl"
+	counts := Distribution{1: 1}
+	var err error
+	switch {
+	case n.operator == "b" || n.operator == "w":
+		counts, err = n.operand1.Distribution(env)
+	case n.kind == NodeTypeInfixOperator:
+		counts, err = n.operand2.Distribution(env)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	source := n.selectionSource()
+	if source.explodesApart() {
+		//the bonus dice are values of their own, which a selection of whole dice doesn't describe
+		return nil, fmt.Errorf("%v - distribution of a selection of exploding dice not supported", n)
+	}
+	d := Distribution{}
+	for count, pc := range counts {
+		var cd Distribution
+		if source.kind == NodeTypeGroup {
+			var k int
+			if k, err = n.selectionSize(count, len(source.operands)); err == nil {
+				cd, err = n.groupSelection(source.operands, env, k, best)
+			}
+		} else {
+			cd, err = source.diceDistribution(env, func(dice int, faces []int, die Distribution) (Distribution, error) {
+				k, err := n.selectionSize(count, dice)
+				if err != nil {
+					return nil, err
+				}
+				return keep(env, dice, die, k, best)
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+		for v, p := range cd {
+			d[v] += pc * p
+		}
+	}
+	return d, nil
+}
+
+//selectionSize is the number of the items kept when count is selected from items.
+func (n *node) selectionSize(count int, items int) (int, error) {
+	switch n.operator {
+	case "dh", "dl":
+		if count < 0 || count > items {
+			return 0, fmt.Errorf("%v can't drop %d items from a slice of %d items", n, count, items)
+		}
+		return items - count, nil
+	case "b", "kh":
+		if count < 0 || count > items {
+			return 0, fmt.Errorf("%v can't gather %d best items from a slice of %d items", n, count, items)
+		}
+	default:
+		if count < 0 || count > items {
+			return 0, fmt.Errorf("%v can't gather %d worst items from a slice of %d items", n, count, items)
+		}
+	}
+	return count, nil
+}
+
+//groupSelection enumerates the joint outcomes of the group members, keeping the k best or worst.
+func (n *node) groupSelection(members []*node, env Environment, k int, best bool) (Distribution, error) {
+	return n.joint(members, env, func(values []int) (int, bool) {
+		picks := sortedIndexes(values)
+		if best {
+			picks = picks[len(picks)-k:]
+		} else {
+			picks = picks[:k]
+		}
+		total := 0
+		for _, pick := range picks {
+			var ok bool
+			if total, ok = add(total, values[pick]); !ok {
+				return 0, false
+			}
+		}
+		return total, true
+	})
+}
+
+//joint is the distribution of fn applied to the values of every joint outcome of the members, failing when fn
+//overflows.
+func (n *node) joint(members []*node, env Environment, fn func(values []int) (int, bool)) (Distribution, error) {
+	outcomes := 1
+	dists := make([]Distribution, len(members))
+	for i, o := range members {
+		od, err := o.Distribution(env)
+		if err != nil {
+			return nil, err
+		}
+		dists[i] = od
+		if outcomes *= len(od); outcomes > maxGroupOutcomes {
+			return nil, fmt.Errorf("%v - too many outcomes to compute a distribution", n)
+		}
+	}
+
+	d := Distribution{}
+	values := make([]int, len(members))
+	overflow := false
+	var enumerate func(i int, p float64)
+	enumerate = func(i int, p float64) {
+		if i == len(members) {
+			v, ok := fn(values)
+			overflow = overflow || !ok
+			d[v] += p
+			return
+		}
+		for v, pv := range dists[i] {
+			values[i] = v
+			enumerate(i+1, p*pv)
+		}
+	}
+	enumerate(0, 1)
+	if overflow {
+		return nil, n.overflow()
+	}
+	return d, nil
+}
+
+//uniform is the distribution of a single die showing any of faces with equal probability.
+func uniform(faces []int) Distribution {
+	d := Distribution{}
+	for _, f := range faces {
+		d[f] += 1 / float64(len(faces))
+	}
+	return d
+}
+
+//identity scores each roll of a die as the value it shows.
+func identity(f int) int {
+	return f
+}
+
+//explodedDie is the distribution of the summed score of the rolls of a single die which rolls a bonus die while
+//the last roll matches c, taking one from each bonus die when it penetrates. Explosions stop at maxExplosions bonus
+//dice, or once the chance of exploding again is too small to change the distribution.
+func explodedDie(env Environment, die Distribution, faces []int, c condition, penetrate bool, score func(f int) int) (Distribution, error) {
+	bonus := uniform(faces)
+	d := Distribution{}
+	exploding := Distribution{}
+	for f, p := range die {
+		if c.match(f) {
+			exploding[score(f)] += p
+		} else {
+			d[score(f)] += p
+		}
+	}
+	if penetrate {
+		bonus = Distribution{}
+		for f, p := range uniform(faces) {
+			bonus[f-1] = p
+		}
+	}
+	for i := 1; i <= maxExplosions && len(exploding) > 0; i++ {
+		if err := env.timeout(); err != nil {
+			return nil, err
+		}
+		next := Distribution{}
+		chance := 0.0
+		for v, p := range exploding {
+			for b, pb := range bonus {
+				f := b
+				if penetrate {
+					f++
+				}
+				sum, ok := add(v, score(b))
+				if !ok {
+					return nil, ErrOverflow
+				}
+				if c.match(f) && i < maxExplosions {
+					next[sum] += p * pb
+					chance += p * pb
+				} else {
+					d[sum] += p * pb
+				}
+			}
+		}
+		if chance < explosionTolerance {
+			for v, p := range next {
+				d[v] += p
+			}
+			break
+		}
+		exploding = next
+	}
+	return d, nil
+}
+
+//rerolledDie is the distribution of a single die rerolled when it matches c, once or until it doesn't match.
+func rerolledDie(die Distribution, faces []int, c condition, once bool) Distribution {
+	reroll := uniform(faces)
+	if !once {
+		for f := range reroll {
+			if c.match(f) {
+				delete(reroll, f)
+			}
+		}
+		reroll = normalize(reroll)
+	}
+	d := Distribution{}
+	for f, p := range die {
+		if !c.match(f) {
+			d[f] += p
+			continue
+		}
+		for r, pr := range reroll {
+			d[r] += p * pr
+		}
+	}
+	return d
+}
+
+//normalize scales the probabilities of d to sum to 1.
+func normalize(d Distribution) Distribution {
+	total := 0.0
+	for _, p := range d {
+		total += p
+	}
+	for v, p := range d {
+		d[v] = p / total
+	}
+	return d
+}
+
+//diceSum is the distribution of the total of count dice.
+type diceSum struct {
+	count int
+	d     Distribution
+}
+
+//sumsOfDice is a diceFn for the distribution of the total of count dice with the die distribution. The sum for each
+//faces is kept, so the sum of more of the same dice convolves only the dice added.
+func sumsOfDice(env Environment) diceFn {
+	sums := map[string]diceSum{}
+	return func(count int, faces []int, die Distribution) (Distribution, error) {
+		key := fmt.Sprint(faces)
+		sum, ok := sums[key]
+		if !ok || sum.count > count {
+			sum = diceSum{d: Distribution{0: 1}}
+		}
+		for ; sum.count < count; sum.count++ {
+			var err error
+			if sum.d, err = convolve(env, sum.d, die); err != nil {
+				return nil, err
+			}
+		}
+		sums[key] = sum
+		return sum.d, nil
+	}
+}
+
+func convolve(env Environment, a, b Distribution) (Distribution, error) {
+	d := Distribution{}
+	for x, px := range a {
+		if err := env.timeout(); err != nil {
+			return nil, err
+		}
+		for y, py := range b {
+			sum, ok := add(x, y)
+			if !ok {
+				return nil, ErrOverflow
+			}
+			d[sum] += px * py
+		}
+	}
+	return d, nil
+}
+
+//combine is the distribution of fn applied to independent outcomes of a and b.
+func combine(env Environment, a, b Distribution, fn func(x, y int) (int, error)) (Distribution, error) {
+	d := Distribution{}
+	for x, px := range a {
+		if err := env.timeout(); err != nil {
+			return nil, err
+		}
+		for y, py := range b {
+			v, err := fn(x, y)
+			if err != nil {
+				return nil, err
+			}
+			d[v] += px * py
+		}
+	}
+	return d, nil
+}
+
+//maximum is the distribution of the highest of independent outcomes of a and b.
+func maximum(env Environment, a, b Distribution) (Distribution, error) {
+	d := Distribution{}
+	for x, px := range a {
+		if err := env.timeout(); err != nil {
+			return nil, err
+		}
+		for y, py := range b {
+			if x > y {
+				d[x] += px * py
+			} else {
+				d[y] += px * py
+			}
+		}
+	}
+	return d, nil
+}
+
+//keep is the distribution of the total of the k highest, or lowest, of count dice with the die distribution.
+//Faces are visited from the first kept to the last, choosing how many of the remaining dice show each face.
+func keep(env Environment, count int, die Distribution, k int, highest bool) (Distribution, error) {
+	values := die.Outcomes()
+	if highest {
+		sort.Sort(sort.Reverse(sort.IntSlice(values)))
+	}
+
+	type state struct{ assigned, total int }
+	states := map[state]float64{{}: 1}
+	for _, v := range values {
+		next := map[state]float64{}
+		for s, p := range states {
+			if err := env.timeout(); err != nil {
+				return nil, err
+			}
+			remaining := count - s.assigned
+			pc := 1.0
+			for c := 0; c <= remaining; c++ {
+				kept := k - s.assigned
+				if kept > c {
+					kept = c
+				}
+				if kept < 0 {
+					kept = 0
+				}
+				scored, ok := mul(kept, v)
+				if ok {
+					scored, ok = add(s.total, scored)
+				}
+				if !ok {
+					return nil, ErrOverflow
+				}
+				next[state{s.assigned + c, scored}] += p * binomial(remaining, c) * pc
+				pc *= die[v]
+			}
+		}
+		states = next
+	}
+
+	d := Distribution{}
+	for s, p := range states {
+		if s.assigned == count {
+			d[s.total] += p
+		}
+	}
+	return d, nil
+}
+
+func binomial(n, k int) float64 {
+	b := 1.0
+	for i := 1; i <= k; i++ {
+		b = b * float64(n-k+i) / float64(i)
+	}
+	return b
+}
@@ -0,0 +1,140 @@
+package lex
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type distributionTestCase struct {
+	p map[int]float64
+	e error
+}
+
+func Test_distribution(t *testing.T) {
+	tests := map[string]distributionTestCase{
+		"":                       {e: errors.New("nill node")},
+		"7":                      {p: map[int]float64{7: 1}},
+		"7/2":                    {p: map[int]float64{3: 1}},
+		"d6":                     {p: map[int]float64{1: 1. / 6, 6: 1. / 6, 7: 0}},
+		"2d6":                    {p: map[int]float64{2: 1. / 36, 7: 6. / 36, 12: 1. / 36}},
+		"2d6+1":                  {p: map[int]float64{3: 1. / 36, 8: 6. / 36, 13: 1. / 36}},
+		"d%":                     {p: map[int]float64{1: 0.01, 100: 0.01}},
+		"4dF":                    {p: map[int]float64{-4: 1. / 81, 0: 19. / 81, 4: 1. / 81}},
+		"2d{1,1,2}":              {p: map[int]float64{2: 4. / 9, 3: 4. / 9, 4: 1. / 9}},
+		"d{-1,0,0,1}":            {p: map[int]float64{-1: 1. / 4, 0: 1. / 2, 1: 1. / 4}},
+		"2d{1,1,2}r1":            {p: map[int]float64{4: 1}},
+		"dAbility":               {p: map[int]float64{0: 4. / 8, 1: 3. / 8, 2: 1. / 8}},
+		"dChallenge":             {p: map[int]float64{0: 5. / 12, -1: 5. / 12, -2: 2. / 12}},
+		"d(1d2)":                 {p: map[int]float64{1: 3. / 4, 2: 1. / 4}},
+		"3b4d6":                  {p: map[int]float64{3: 1. / 1296, 18: 21. / 1296}},
+		"1w2d20":                 {p: map[int]float64{1: 39. / 400, 20: 1. / 400}},
+		"4d6dl1":                 {p: map[int]float64{3: 1. / 1296, 18: 21. / 1296}},
+		"2d20kh":                 {p: map[int]float64{1: 1. / 400, 20: 39. / 400}},
+		"2d20kl1":                {p: map[int]float64{1: 39. / 400, 20: 1. / 400}},
+		"3d6dh2":                 {p: map[int]float64{1: 91. / 216, 6: 1. / 216}},
+		"d6r1":                   {p: map[int]float64{1: 0, 2: 1. / 5, 6: 1. / 5}},
+		"d6ro1":                  {p: map[int]float64{1: 1. / 36, 2: 7. / 36}},
+		"d6r<=2":                 {p: map[int]float64{2: 0, 3: 1. / 4}},
+		"2d6r<7":                 {e: errors.New("((2d6)r(<7)) - every face would be rerolled")},
+		"2d6#>4":                 {p: map[int]float64{0: 4. / 9, 1: 4. / 9, 2: 1. / 9}},
+		"d10#>=7f1":              {p: map[int]float64{-1: 0.1, 0: 0.5, 1: 0.4}},
+		"1b(d6,d6)":              {p: map[int]float64{1: 1. / 36, 6: 11. / 36}},
+		"2w(3,1,2)":              {p: map[int]float64{3: 1}},
+		"d6!":                    {p: map[int]float64{5: 1. / 6, 6: 0, 7: 1. / 36, 12: 0, 13: 1. / 216}},
+		"-d4":                    {p: map[int]float64{-4: 1. / 4, -1: 1. / 4, 1: 0}},
+		"2d4*-1":                 {p: map[int]float64{-8: 1. / 16, -5: 1. / 4, 2: 0}},
+		"d6 >= 4":                {p: map[int]float64{0: 1. / 2, 1: 1. / 2}},
+		"d6 > 4 && d6 > 4":       {p: map[int]float64{0: 8. / 9, 1: 1. / 9}},
+		"d20 >= 11 || d20 >= 11": {p: map[int]float64{0: 1. / 4, 1: 3. / 4}},
+		"d6 && 1":                {e: errors.New("((1d6)&&1) - && can only combine checks")},
+		"ceil(d4/2)":             {p: map[int]float64{1: 1. / 2, 2: 1. / 2}},
+		"round(d6/4)":            {p: map[int]float64{0: 1. / 6, 1: 4. / 6, 2: 1. / 6}},
+		"round(d6/4*3)":          {p: map[int]float64{1: 1. / 6, 2: 2. / 6, 3: 1. / 6, 4: 1. / 6, 5: 1. / 6}},
+		"ceil(d4/2+1)":           {p: map[int]float64{2: 1. / 2, 3: 1. / 2, 4: 0}},
+		"floor(d4/(d2-1))":       {e: errors.New("divide by zero in ((1d4)/((1d2)-1))")},
+		"max(d6,d6)":             {p: map[int]float64{1: 1. / 36, 6: 11. / 36}},
+		"clamp(d6,2,5)":          {p: map[int]float64{1: 0, 2: 2. / 6, 3: 1. / 6, 5: 2. / 6}},
+		"d6!!":                   {p: map[int]float64{5: 1. / 6, 6: 0, 7: 1. / 36, 12: 0, 13: 1. / 216}},
+		"d6!p":                   {p: map[int]float64{5: 1. / 6, 6: 1. / 36, 11: 1. / 216, 12: 1. / 216}},
+		"d10!>=9":                {p: map[int]float64{8: 1. / 10, 9: 0, 10: 1. / 100, 11: 2. / 100, 19: 1. / 1000}},
+		"d6!>0":                  {e: errors.New("((1d6)!(>0)) - every face would explode")},
+		"3d6!kh2":                {e: errors.New("(((3d6)!)kh2) - distribution of a selection of exploding dice not supported")},
+		"2b3d6!p":                {e: errors.New("(2b((3d6)!p)) - distribution of a selection of exploding dice not supported")},
+		"4d6!r1":                 {e: errors.New("(((4d6)!)r1) - distribution of rerolled exploding dice not supported")},
+		"4d6!kh3#>4":             {e: errors.New("((((4d6)!)kh3)#>4) - distribution of a count of modified exploding dice not supported")},
+		"4d6!#>=5":               {p: map[int]float64{0: 16. / 81}},
+		"d4w":                    {p: map[int]float64{1: 1. / 24, 2: 1. / 8}},
+		"d1w":                    {e: errors.New("((1d1)w) - every face would explode")},
+		"d4!w":                   {e: errors.New("(((1d4)!)w) - can't wild roll exploding dice, trait dice already explode")},
+		"1/(d2-1)":               {e: errors.New("divide by zero in (1/((1d2)-1))")},
+		"4b2d6":                  {e: errors.New("(4b(2d6)) can't gather 4 best items from a slice of 2 items")},
+		"3!":                     {e: errors.New("(3!) - can't explode a leaf node")},
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		d, err := ast.Distribution(Environment{})
+		if expected.e != nil || err != nil {
+			if expected.e == nil || err == nil || !strings.EqualFold(expected.e.Error(), err.Error()) {
+				t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected.e, err)
+			}
+			continue
+		}
+		total := 0.0
+		for _, p := range d {
+			total += p
+		}
+		if math.Abs(total-1) > 1e-9 {
+			t.Errorf("ERROR %v probabilities sum to %v", test, total)
+		}
+		for v, p := range expected.p {
+			if math.Abs(d[v]-p) > 1e-9 {
+				t.Errorf("ERROR %v\texpected P(%d) = %v\tgot\t%v", test, v, p, d[v])
+			}
+		}
+		t.Logf("OK %12v distributed as %v", test, d)
+	}
+}
+
+func Test_distribution_covers_rolls(t *testing.T) {
+	const samples = 20000
+	r := rand.New(rand.NewSource(11))
+	for _, test := range []string{"3d6+2", "3b4d6", "2w4d6-1", "4dF*2", "2d6!", "3d6!!", "3d6!p", "4d6!!>4kh3", "d8w", "1b(d6,d8,2d4)", "(d4)d6", "4d6kh3", "5d6dl2", "(d6,d8,d10)kl2", "4d6r1kh3", "2d6ro<3", "3d6r>4!", "8d10#>=7f1", "6d6r1#>4", "4d6!#>=5", "3d6!p#>=3f1", "max(1,d6-2)", "floor(3d6/4)", "round(d6/4*3)", "ceil(-(d10/3)+(d4,1)/2)", "2d{1,1,2,2,3,4}kh1", "d{-1,0,0,1}!+4dF", "3d{2,4}!p", "2dAbility+dProficiency+2dDifficulty"} {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		d, err := ast.Distribution(Environment{})
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		rolled := map[int]int{}
+		sum := 0.0
+		for i := 0; i < samples; i++ {
+			v, err := total(ast, r, Environment{})
+			if err != nil {
+				t.Fatal("ERROR", test, err)
+			}
+			if d[v] <= 0 {
+				t.Fatalf("ERROR %v rolled %d which has probability %v", test, v, d[v])
+			}
+			rolled[v]++
+			sum += float64(v)
+		}
+		stats := d.Statistics()
+		if mean := sum / samples; math.Abs(mean-stats.Mean) > 5*stats.StdDev/math.Sqrt(samples) {
+			t.Errorf("ERROR %v\texpected mean\t%.3f\trolled\t%.3f", test, stats.Mean, mean)
+		}
+		for v, p := range d {
+			if f := float64(rolled[v]) / samples; math.Abs(f-p) > 5*math.Sqrt(p*(1-p)/samples)+1./samples {
+				t.Errorf("ERROR %v\texpected %d with probability\t%.4f\trolled\t%.4f", test, v, p, f)
+			}
+		}
+	}
+}
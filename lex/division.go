@@ -0,0 +1,170 @@
+package lex
+
+import (
+	"fmt"
+	"math/big"
+)
+
+//Division is how `/` rounds a quotient which isn't a whole number.
+type Division byte
+
+const (
+	//DivideTruncate rounds toward zero, `-7/2` is -3. It is the default.
+	DivideTruncate Division = iota
+	//DivideDown rounds down, `-7/2` is -4, as when D&D halves damage.
+	DivideDown
+	//DivideUp rounds up, `7/2` is 4.
+	DivideUp
+	//DivideHalf rounds to the nearest whole number, halves away from zero, `7/2` is 4 and `-7/2` is -4.
+	DivideHalf
+)
+
+//divisions round quotients as `floor`, `ceil` and `round` do.
+var divisions = map[Division]func(x, y int) int{
+	DivideTruncate: func(x, y int) int { return x / y },
+	DivideDown:     rounding["floor"],
+	DivideUp:       rounding["ceil"],
+	DivideHalf:     rounding["round"],
+}
+
+//Fraction is the exact total of the evaluation, keeping the fractions of quotients `/` rounded away.
+//Quotients used as the operands of dice, selections and functions are rounded.
+func (e *Evaluation) Fraction() *big.Rat {
+	return e.root.Fraction()
+}
+
+//Fraction is the exact total of the node, as Evaluation.Fraction.
+func (n *rolled) Fraction() *big.Rat {
+	if n == nil {
+		return new(big.Rat)
+	}
+	switch {
+	case n.kind == NodeTypeInfixOperator && !n.check:
+		switch n.operator {
+		case "+":
+			return new(big.Rat).Add(n.operand1.Fraction(), n.operand2.Fraction())
+		case "-":
+			return new(big.Rat).Sub(n.operand1.Fraction(), n.operand2.Fraction())
+		case "*":
+			return new(big.Rat).Mul(n.operand1.Fraction(), n.operand2.Fraction())
+		case "/":
+			if divisor := n.operand2.Fraction(); divisor.Sign() != 0 {
+				return new(big.Rat).Quo(n.operand1.Fraction(), divisor)
+			}
+		}
+	case n.kind == NodeTypePrefixOperator && n.operator == "-":
+		return new(big.Rat).Neg(n.operand1.Fraction())
+	case n.kind == NodeTypeGroup:
+		total := new(big.Rat)
+		for _, o := range n.operands {
+			total.Add(total, o.Fraction())
+		}
+		return total
+	}
+	return big.NewRat(int64(n.v), 1)
+}
+
+//fractions are the exact totals a node can take and their probabilities, keyed by the totals' RatString.
+type fractions map[string]fraction
+
+//fraction is an exact total and its probability.
+type fraction struct {
+	v *big.Rat
+	p float64
+}
+
+//add adds p to the probability of the total v.
+func (d fractions) add(v *big.Rat, p float64) {
+	k := v.RatString()
+	f, ok := d[k]
+	if !ok {
+		f.v = v
+	}
+	f.p += p
+	d[k] = f
+}
+
+//fractionDistribution is the probability of each exact total of the node, keeping the fractions of quotients as
+//Fraction does, for the rounding functions to round.
+func (n *node) fractionDistribution(env Environment) (fractions, error) {
+	if err := env.timeout(); err != nil {
+		return nil, err
+	}
+	switch {
+	case n.kind == NodeTypeInfixOperator && !n.check && (n.operator == "+" || n.operator == "-" || n.operator == "*" || n.operator == "/"):
+		left, err := n.operand1.fractionDistribution(env)
+		if err != nil {
+			return nil, err
+		}
+		right, err := n.operand2.fractionDistribution(env)
+		if err != nil {
+			return nil, err
+		}
+		return combineFractions(env, left, right, func(x, y *big.Rat) (*big.Rat, error) {
+			switch n.operator {
+			case "+":
+				return new(big.Rat).Add(x, y), nil
+			case "-":
+				return new(big.Rat).Sub(x, y), nil
+			case "*":
+				return new(big.Rat).Mul(x, y), nil
+			}
+			if y.Sign() == 0 {
+				return nil, fmt.Errorf("divide by zero in %v", n)
+			}
+			return new(big.Rat).Quo(x, y), nil
+		})
+	case n.kind == NodeTypePrefixOperator && n.operator == "-":
+		d, err := n.operand1.fractionDistribution(env)
+		if err != nil {
+			return nil, err
+		}
+		negated := fractions{}
+		for _, f := range d {
+			negated.add(new(big.Rat).Neg(f.v), f.p)
+		}
+		return negated, nil
+	case n.kind == NodeTypeGroup:
+		total := fractions{}
+		total.add(new(big.Rat), 1)
+		for _, o := range n.operands {
+			od, err := o.fractionDistribution(env)
+			if err != nil {
+				return nil, err
+			}
+			if total, err = combineFractions(env, total, od, func(x, y *big.Rat) (*big.Rat, error) {
+				return new(big.Rat).Add(x, y), nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return total, nil
+	}
+	d, err := n.Distribution(env)
+	if err != nil {
+		return nil, err
+	}
+	whole := fractions{}
+	for v, p := range d {
+		whole.add(big.NewRat(int64(v), 1), p)
+	}
+	return whole, nil
+}
+
+//combineFractions is the distribution of fn applied to every pair of totals of a and b.
+func combineFractions(env Environment, a, b fractions, fn func(x, y *big.Rat) (*big.Rat, error)) (fractions, error) {
+	d := fractions{}
+	for _, x := range a {
+		if err := env.timeout(); err != nil {
+			return nil, err
+		}
+		for _, y := range b {
+			v, err := fn(x.v, y.v)
+			if err != nil {
+				return nil, err
+			}
+			d.add(v, x.p*y.p)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,58 @@
+package lex
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_division(t *testing.T) {
+	tests := map[string][]int{
+		//truncate, down, up, half
+		"7/2":       {3, 3, 4, 4},
+		"-7/2":      {-3, -4, -3, -4},
+		"7/3":       {2, 2, 3, 2},
+		"8/2":       {4, 4, 4, 4},
+		"(9/2)d1":   {4, 4, 5, 5},
+		"ceil(5/2)": {3, 3, 3, 3},
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		for d, e := range expected {
+			v, err := total(ast, rand.New(rand.NewSource(11)), Environment{Division: Division(d)})
+			if err != nil || v != e {
+				t.Errorf("ERROR %v division %d\texpected\t%d\tgot\t%d %v", test, d, e, v, err)
+			}
+		}
+	}
+}
+
+func Test_fraction(t *testing.T) {
+	tests := map[string]string{
+		"7/2":          "7/2",
+		"-7/2+1/3":     "-19/6",
+		"7/2*2":        "7/1",
+		"(7/2,1/2)":    "4/1",
+		"(7/2)d1":      "3/1",
+		"floor(7/2)/2": "3/2",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		e, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		if f := e.Fraction(); f.String() != expected {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, f)
+		}
+	}
+}
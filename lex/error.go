@@ -0,0 +1,114 @@
+package lex
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//ErrorCategory classifies a ParseError.
+type ErrorCategory byte
+
+const (
+	//ErrorCharacter is a character which can't start or continue a token, such as the `^` of `7^3`.
+	ErrorCharacter ErrorCategory = iota
+	//ErrorSyntax is a token out of place, such as an operator missing an operand or an unbalanced parenthesis.
+	ErrorSyntax
+	//ErrorNumber is a malformed number or list of faces, or a number too large for an int.
+	ErrorNumber
+	//ErrorName is the name of an unknown die or macro.
+	ErrorName
+	//ErrorArguments is a call to a function or macro with the wrong number of arguments.
+	ErrorArguments
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrorCharacter:
+		return "character"
+	case ErrorSyntax:
+		return "syntax"
+	case ErrorNumber:
+		return "number"
+	case ErrorName:
+		return "name"
+	default:
+		return "arguments"
+	}
+}
+
+//ParseError is an expression which couldn't be parsed, located at the offending token.
+type ParseError struct {
+	Category ErrorCategory
+	//Offset of the offending token in the expression, in bytes. The end of the expression is at its length.
+	Offset int
+	//Token is the text of the offending token, empty at the end of the expression.
+	Token string
+	//Err describes the error.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+//Render prints the input the error was found in with a caret under each character of the offending token:
+//
+//	3d6+*2
+//	    ^
+func (e *ParseError) Render(input string) string {
+	offset := e.Offset
+	if offset > len(input) {
+		offset = len(input)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	var caret strings.Builder
+	for _, c := range input[:offset] {
+		if c == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	carets := utf8.RuneCountInString(e.Token)
+	if carets == 0 {
+		carets = 1
+	}
+	caret.WriteString(strings.Repeat("^", carets))
+	return input + "\n" + caret.String()
+}
+
+//parseError is an error of the category found at a token the parser locates once it knows the token.
+func parseError(category ErrorCategory, format string, a ...interface{}) *ParseError {
+	return &ParseError{Category: category, Offset: -1, Err: fmt.Errorf(format, a...)}
+}
+
+//unhandledChar is the error of the character c at the offset, which can't start or continue a token.
+func unhandledChar(c byte, offset int) *ParseError {
+	return &ParseError{
+		Category: ErrorCharacter,
+		Offset:   offset,
+		Token:    string(c),
+		Err:      fmt.Errorf("unhandled char: %c @ offset %d", c, offset),
+	}
+}
+
+//locate places an error found parsing the token t at the token, unless it is already located.
+func locate(err error, t Token) error {
+	return at(err, t.Offset, t.Value)
+}
+
+//at places an error at the token starting at offset, unless it is already located.
+func at(err error, offset int, token string) error {
+	if pe, ok := err.(*ParseError); ok && pe.Offset < 0 {
+		pe.Offset = offset
+		pe.Token = token
+	}
+	return err
+}
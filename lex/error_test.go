@@ -0,0 +1,119 @@
+package lex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_parse_errors(t *testing.T) {
+	tests := map[string]struct {
+		category ErrorCategory
+		offset   int
+		token    string
+		render   string
+	}{
+		"7^3":         {category: ErrorCharacter, offset: 1, token: "^", render: "7^3\n ^"},
+		"d6 &":        {category: ErrorSyntax, offset: 3, token: "&", render: "d6 &\n   ^"},
+		"1&2":         {category: ErrorSyntax, offset: 1, token: "&", render: "1&2\n ^"},
+		"3d6+*2":      {category: ErrorSyntax, offset: 4, token: "*", render: "3d6+*2\n    ^"},
+		"/2":          {category: ErrorSyntax, offset: 0, token: "/", render: "/2\n^"},
+		"2d6+@":       {category: ErrorCharacter, offset: 4, token: "@", render: "2d6+@\n    ^"},
+		"\t2d6 + 7^3": {category: ErrorCharacter, offset: 8, token: "^", render: "\t2d6 + 7^3\n\t       ^"},
+		"2d6+":        {category: ErrorSyntax, offset: 4, render: "2d6+\n    ^"},
+		"(1+2":        {category: ErrorSyntax, offset: 0, token: "(", render: "(1+2\n^"},
+		"3*(1+2":      {category: ErrorSyntax, offset: 2, token: "(", render: "3*(1+2\n  ^"},
+		"1+2)":        {category: ErrorSyntax, offset: 3, token: ")", render: "1+2)\n   ^"},
+		"3 4":         {category: ErrorSyntax, offset: 2, token: "4", render: "3 4\n  ^"},
+		"1,2":         {category: ErrorSyntax, offset: 1, token: ",", render: "1,2\n ^"},
+		"d{1,2":       {category: ErrorSyntax, offset: 0, token: "d{1,2", render: "d{1,2\n^^^^^"},
+		"1..2+1":      {category: ErrorNumber, offset: 0, token: "1..2", render: "1..2+1\n^^^^"},
+		"1+99999999999999999999": {category: ErrorNumber, offset: 2, token: "99999999999999999999",
+			render: "1+99999999999999999999\n  ^^^^^^^^^^^^^^^^^^^^"},
+		"2+fireball": {category: ErrorName, offset: 2, token: "fireball", render: "2+fireball\n  ^^^^^^^^"},
+		"2dFo":       {category: ErrorName, offset: 1, token: "dFo", render: "2dFo\n ^^^"},
+		"1+floor(1,2)": {category: ErrorArguments, offset: 2, token: "floor",
+			render: "1+floor(1,2)\n  ^^^^^"},
+		"1+adv(1,2": {category: ErrorSyntax, offset: 2, token: "adv(", render: "1+adv(1,2\n  ^^^^"},
+		"d20 >= 15 >= 2": {category: ErrorSyntax, offset: 10, token: ">=",
+			render: "d20 >= 15 >= 2\n          ^^"},
+		"8d10>=7":      {category: ErrorSyntax, offset: 4, token: ">=", render: "8d10>=7\n    ^^"},
+		"2d6 < 7 && 1": {category: ErrorSyntax, offset: 4, token: "<", render: "2d6 < 7 && 1\n    ^"},
+		"(d4)d6 > 3":   {category: ErrorSyntax, offset: 7, token: ">", render: "(d4)d6 > 3\n       ^"},
+		"2#4":          {category: ErrorCharacter, offset: 2, token: "4", render: "2#4\n  ^"},
+		"#>4":          {category: ErrorCharacter, offset: 0, token: "#", render: "#>4\n^"},
+	}
+	for test, expected := range tests {
+		_, err := NewParserWithDice(strings.NewReader(test), Macros{}, NamedDice{"Foo": {1, 2}}).Parse()
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("ERROR %q\texpected\tparse error\tgot\t%v", test, err)
+			continue
+		}
+		if parseErr.Category != expected.category || parseErr.Offset != expected.offset || parseErr.Token != expected.token {
+			t.Errorf("ERROR %q\texpected\t%v %d %q\tgot\t%v %d %q", test, expected.category, expected.offset,
+				expected.token, parseErr.Category, parseErr.Offset, parseErr.Token)
+		}
+		if render := parseErr.Render(test); render != expected.render {
+			t.Errorf("ERROR %q\texpected\n%s\ngot\n%s", test, expected.render, render)
+		}
+	}
+}
+
+func Test_parse_error_messages(t *testing.T) {
+	tests := map[string]string{
+		"7^3":                  "unhandled char: ^ @ offset 1",
+		"2d6+":                 "parse error: unexpected end of expression",
+		"99999999999999999999": "parse error: integer overflow in 99999999999999999999",
+		"d{1,x}":               "unhandled char: x @ offset 4",
+		"1&2":                  "parse error: expected &&",
+		"3d6+*2":               "parse error: missing left operand of *",
+		"6d6>4":                "parse error: ambiguous > on the dice pool (6d6), count successes with #> or check the total of the pool in parentheses",
+	}
+	for test, expected := range tests {
+		_, err := NewParser(strings.NewReader(test)).Parse()
+		if err == nil || err.Error() != expected {
+			t.Errorf("ERROR %q\texpected\t%s\tgot\t%v", test, expected, err)
+		}
+	}
+	_, err := NewParser(strings.NewReader("99999999999999999999")).Parse()
+	if !errors.Is(err, ErrOverflow) {
+		t.Error("ERROR expected the parse error to wrap ErrOverflow, got", err)
+	}
+}
+
+func Test_render(t *testing.T) {
+	tests := map[string]struct {
+		err      ParseError
+		input    string
+		expected string
+	}{
+		"end":      {err: ParseError{Offset: 3}, input: "1+2", expected: "1+2\n   ^"},
+		"past end": {err: ParseError{Offset: 9}, input: "1+2", expected: "1+2\n   ^"},
+		"negative": {err: ParseError{Offset: -1}, input: "1+2", expected: "1+2\n^"},
+		"runes":    {err: ParseError{Offset: 3, Token: "x"}, input: "é+x", expected: "é+x\n  ^"},
+		"token":    {err: ParseError{Offset: 2, Token: "ab"}, input: "1+ab", expected: "1+ab\n  ^^"},
+	}
+	for test, tc := range tests {
+		if render := tc.err.Render(tc.input); render != tc.expected {
+			t.Errorf("ERROR %v\texpected\n%s\ngot\n%s", test, tc.expected, render)
+		}
+	}
+}
+
+func Test_token_offsets(t *testing.T) {
+	var offsets []int
+	NewLexer(strings.NewReader("3d6 + (2, @str)kh1")).Lex(func(t Token) {
+		offsets = append(offsets, t.Offset)
+	})
+	expected := []int{0, 1, 2, 4, 6, 7, 8, 10, 14, 15, 17, 18}
+	if len(offsets) != len(expected) {
+		t.Fatalf("ERROR expected %v got %v", expected, offsets)
+	}
+	for i := range expected {
+		if offsets[i] != expected[i] {
+			t.Errorf("ERROR expected %v got %v", expected, offsets)
+			break
+		}
+	}
+}
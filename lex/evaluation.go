@@ -0,0 +1,96 @@
+package lex
+
+//Environment is what an AST is evaluated with besides its dice.
+type Environment struct {
+	//Variables are the values of the AST's `@` variables.
+	Variables Variables
+	//Division is how the AST's `/` operators round.
+	Division Division
+	//Limits bound the dice the AST may roll, their sides and the time evaluating it may take.
+	Limits Limits
+	//budget is the dice and time left to evaluate the AST or compute its distribution, shared by the AST's nodes and
+	//by the ASTs of EvaluateAll.
+	budget *budget
+}
+
+//timeout fails once the distribution computed in the environment has run out of time.
+func (env Environment) timeout() error {
+	if env.budget == nil {
+		return nil
+	}
+	return env.budget.timeout()
+}
+
+//EvaluateAll evaluates each of the asts in the environment env, rolling their dice with r. The asts share the
+//environment's limits, so together they roll no more dice and take no longer than one AST may.
+func EvaluateAll(asts []AST, r Source, env Environment) ([]*Evaluation, error) {
+	env.budget = newBudget(env.Limits)
+	evaluations := make([]*Evaluation, len(asts))
+	for i, ast := range asts {
+		e, err := ast.Evaluate(r, env)
+		if err != nil {
+			return nil, err
+		}
+		evaluations[i] = e
+	}
+	return evaluations, nil
+}
+
+//Evaluation is the outcome of evaluating an AST once. It mirrors the shape of the AST, recording the values and
+//dice of each node, while the AST itself is left untouched.
+type Evaluation struct {
+	root *rolled
+}
+
+//Total of the evaluation.
+func (e *Evaluation) Total() int {
+	return e.root.v
+}
+
+//Values are the results the total was made of, such as each die kept by `3b4d6`.
+func (e *Evaluation) Values() []int {
+	return e.root.vs
+}
+
+//Plan describes how each node of the AST was evaluated.
+func (e *Evaluation) Plan() string {
+	return e.root.Plan()
+}
+
+//Result describes every node, operand and die of the evaluation.
+func (e *Evaluation) Result() *RollResult {
+	return e.root.Result()
+}
+
+//rolled is a node of an evaluation, the values and dice of the AST node it mirrors.
+type rolled struct {
+	*node
+	v        int
+	vs       []int
+	operand1 *rolled
+	operand2 *rolled
+	operands []*rolled
+	picks    []int
+	dice     []Die
+	wild     *wildRoll
+	margin   int
+	env      *Environment
+	budget   *budget
+}
+
+//rolled mirrors the node and the nodes beneath it, ready to be evaluated in env within the budget.
+func (n *node) rolled(env *Environment, b *budget) *rolled {
+	if n == nil {
+		return nil
+	}
+	r := &rolled{node: n, v: n.v, env: env, budget: b}
+	r.operand1 = n.operand1.rolled(env, b)
+	r.operand2 = n.operand2.rolled(env, b)
+	if n.operands != nil {
+		r.operands = make([]*rolled, len(n.operands))
+		for i, o := range n.operands {
+			r.operands[i] = o.rolled(env, b)
+		}
+	}
+	return r
+}
@@ -0,0 +1,70 @@
+package lex
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func total(ast AST, r Source, env Environment) (int, error) {
+	e, err := ast.Evaluate(r, env)
+	if err != nil {
+		return 0, err
+	}
+	return e.Total(), nil
+}
+
+func Test_evaluation(t *testing.T) {
+	ast, err := NewParser(strings.NewReader("4d6kh3+(d4,@x)")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ast.String()
+	first, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{Variables: Variables{"x": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ast.Evaluate(rand.New(rand.NewSource(12)), Environment{Variables: Variables{"x": 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.String() != s {
+		t.Errorf("ERROR evaluating %v changed it to %v", s, ast)
+	}
+	if first.Total() == second.Total() || first.Plan() == second.Plan() {
+		t.Errorf("ERROR evaluations share their results: %v and %v", first.Plan(), second.Plan())
+	}
+	if dice := first.Result().Operands[0].Operands[0].Dice; len(dice) != 4 {
+		t.Errorf("ERROR expected 4 dice got %v", dice)
+	}
+	if _, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{}); err == nil {
+		t.Error("ERROR expected the variable to be unbound")
+	}
+}
+
+func Test_concurrent_evaluation(t *testing.T) {
+	ast, err := NewParser(strings.NewReader("4d6kh3+1b(d8,2d4)+@x")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{Variables: Variables{"x": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{Variables: Variables{"x": 1}})
+				if err != nil || e.Plan() != expected.Plan() {
+					t.Errorf("ERROR expected %v got %v %v", expected.Plan(), e, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,155 @@
+package lex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//NamedDice are the dice with custom faces known to a parser by name, such as the `Avg` rolled by `2dAvg`.
+type NamedDice map[string][]int
+
+//fudgeFaces are the faces of a fudge die.
+var fudgeFaces = []int{-1, 0, 1}
+
+//builtinDice are the named dice every parser knows.
+var builtinDice = NamedDice{"F": fudgeFaces}
+
+//Define names a die with faces, such as `Avg` with the faces 2, 3, 3, 4, 4 and 5.
+//A name starts with a capital letter, so `dAvg` can't be mistaken for dice followed by a modifier.
+func (d NamedDice) Define(name string, faces []int) error {
+	if !isDieName(name) {
+		return fmt.Errorf("not a die name: %s", name)
+	}
+	if _, ok := builtinDice.faces(name); ok {
+		return fmt.Errorf("d%s is a builtin die", name)
+	}
+	if len(faces) == 0 {
+		return fmt.Errorf("die d%s has no faces", name)
+	}
+	d[name] = append([]int{}, faces...)
+	return nil
+}
+
+//faces are the faces of the builtin, narrative or named die name. A narrative die's faces are their net successes.
+func (d NamedDice) faces(name string) ([]int, bool) {
+	if faces, ok := builtinDice[name]; ok {
+		return faces, true
+	}
+	if symbols, ok := narrativeDice[name]; ok {
+		return netSuccesses(symbols), true
+	}
+	faces, ok := d[name]
+	return faces, ok
+}
+
+//isPrefix is true when some builtin, narrative or named die's name starts with prefix.
+func (d NamedDice) isPrefix(prefix string) bool {
+	for _, dice := range []NamedDice{builtinDice, d} {
+		for name := range dice {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	for name := range narrativeDice {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+//isDieName is true of a capital letter followed by letters, digits and underscores.
+func isDieName(name string) bool {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isIdentifier(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//parseFaces reads the faces listed by a custom die operator such as `d{1,1,2,2,3,4}`.
+func parseFaces(operator string) ([]int, error) {
+	list := strings.TrimSuffix(strings.TrimPrefix(operator, "d{"), "}")
+	var faces []int
+	for _, face := range strings.Split(list, ",") {
+		f, err := strconv.Atoi(face)
+		if err != nil {
+			return nil, parseError(ErrorNumber, "parse error: malformed faces %s", operator)
+		}
+		faces = append(faces, f)
+	}
+	return faces, nil
+}
+
+//dieFaces are the faces of a die with sides sides.
+func dieFaces(sides int) []int {
+	faces := make([]int, sides)
+	for i := range faces {
+		faces[i] = i + 1
+	}
+	return faces
+}
+
+//dieType describes the dice a modifier rerolls, explodes or counts. Numbered dice are described by their sides, so
+//they don't list their faces however many sides they have. Only custom and named dice list their faces.
+type dieType struct {
+	sides int
+	//faces of a custom or named die, nil for a numbered die showing 1 to sides
+	faces []int
+}
+
+//numberedDie is a die showing 1 to sides.
+func numberedDie(sides int) dieType {
+	return dieType{sides: sides}
+}
+
+//facedDie is a die showing any of faces.
+func facedDie(faces []int) dieType {
+	return dieType{sides: len(faces), faces: faces}
+}
+
+//face is the face on the side of the die, counting sides from 0.
+func (d dieType) face(side int) int {
+	if d.faces == nil {
+		return side + 1
+	}
+	return d.faces[side]
+}
+
+//lowest and highest are the die's lowest and highest faces.
+func (d dieType) lowest() int {
+	if d.faces == nil {
+		return 1
+	}
+	lowest := d.faces[0]
+	for _, f := range d.faces {
+		if f < lowest {
+			lowest = f
+		}
+	}
+	return lowest
+}
+
+func (d dieType) highest() int {
+	if d.faces == nil {
+		return d.sides
+	}
+	highest := d.faces[0]
+	for _, f := range d.faces {
+		if f > highest {
+			highest = f
+		}
+	}
+	return highest
+}
+
+//roll rolls a single die showing any of its faces with equal probability.
+func (d dieType) roll(r Source) int {
+	return d.face(r.Intn(d.sides))
+}
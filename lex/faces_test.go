@@ -0,0 +1,95 @@
+package lex
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_custom_dice(t *testing.T) {
+	dice := NamedDice{}
+	if err := dice.Define("Avg", []int{2, 3, 3, 4, 4, 5}); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if err := dice.Define("H", []int{1, 2, 2, 3, 3, 3}); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	tests := map[string]struct {
+		min, max int
+		s        string
+	}{
+		"2d{1,1,2,2,3,4}": {min: 2, max: 8, s: "(2d{1,1,2,2,3,4})"},
+		"d{-1,0,0,1}*2":   {min: -2, max: 2, s: "((1d{-1,0,0,1})*2)"},
+		"3dAvgkh2":        {min: 4, max: 10, s: "((3dAvg)kh2)"},
+		"dH+dF":           {min: 0, max: 4, s: "((1dH)+(1dF))"},
+		"4dFkh3":          {min: -3, max: 3, s: "((4dF)kh3)"},
+		"2d{2,4}r2":       {min: 8, max: 8, s: "((2d{2,4})r2)"},
+	}
+	r := rand.New(rand.NewSource(11))
+	for test, expected := range tests {
+		ast, err := NewParserWithDice(strings.NewReader(test), nil, dice).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		if ast.String() != expected.s {
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected.s, ast)
+		}
+		for i := 0; i < 100; i++ {
+			v, err := total(ast, r, Environment{})
+			if err != nil || v < expected.min || v > expected.max {
+				t.Fatalf("ERROR %v\texpected\t[%d,%d]\tgot\t%d %v", test, expected.min, expected.max, v, err)
+			}
+		}
+		t.Logf("OK %16v parsed as %v", test, ast)
+	}
+}
+
+func Test_custom_dice_errors(t *testing.T) {
+	dice := NamedDice{"Avg": {2, 3, 3, 4, 4, 5}}
+	tests := map[string]string{
+		"dAvx":     "parse error: unknown die dAvx",
+		"dAv":      "parse error: unknown die dAv",
+		"d{1,,2}":  "parse error: malformed faces d{1,,2}",
+		"d{}":      "parse error: malformed faces d{}",
+		"d{3,3}!":  "((1d{3,3})!) - every face would explode",
+		"dAvg+dH1": "parse error: unknown die dH1",
+	}
+	for test, expected := range tests {
+		ast, err := NewParserWithDice(strings.NewReader(test), nil, dice).Parse()
+		if err == nil {
+			_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		}
+		if err == nil || err.Error() != expected {
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected, err)
+		}
+	}
+}
+
+func Test_define_die(t *testing.T) {
+	tests := map[string]struct {
+		faces []int
+		e     string
+	}{
+		"Hit":   {faces: []int{1, 2, 3}},
+		"avg":   {faces: []int{1}, e: "not a die name: avg"},
+		"A-1":   {faces: []int{1}, e: "not a die name: A-1"},
+		"F":     {faces: []int{1}, e: "dF is a builtin die"},
+		"Empty": {e: "die dEmpty has no faces"},
+	}
+	for test, expected := range tests {
+		err := NamedDice{}.Define(test, expected.faces)
+		if expected.e == "" && err != nil || expected.e != "" && (err == nil || err.Error() != expected.e) {
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected.e, err)
+		}
+	}
+
+	dice := NamedDice{"H": {1, 2, 2, 3}}
+	macros := Macros{}
+	if err := macros.DefineWithDice("hit = dH+1", dice); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if err := macros.Define("dHit = 2"); err == nil {
+		t.Error("ERROR dHit = 2 expected error, dH is a named die")
+	}
+}
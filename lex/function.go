@@ -0,0 +1,188 @@
+package lex
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+//builtin is a function of the expression language, such as `max(1, d6-2)`.
+type builtin struct {
+	//args is the number of arguments the function takes, or -1 for one or more.
+	args int
+	//apply is the function's result, false when it overflows.
+	apply func(values []int) (int, bool)
+}
+
+//builtins are the functions every expression may call. Macros can't be named after them.
+var builtins = map[string]builtin{
+	"min":   {args: -1, apply: func(values []int) (int, bool) { return values[sortedIndexes(values)[0]], true }},
+	"max":   {args: -1, apply: func(values []int) (int, bool) { return values[sortedIndexes(values)[len(values)-1]], true }},
+	"abs":   {args: 1, apply: func(values []int) (int, bool) { return abs(values[0]) }},
+	"floor": {args: 1, apply: func(values []int) (int, bool) { return values[0], true }},
+	"ceil":  {args: 1, apply: func(values []int) (int, bool) { return values[0], true }},
+	"round": {args: 1, apply: func(values []int) (int, bool) { return values[0], true }},
+	"clamp": {args: 3, apply: func(values []int) (int, bool) { return clamp(values[0], values[1], values[2]), true }},
+}
+
+//rounding divides x by y as the rounding functions `floor`, `ceil` and `round` round, for the divisions rounding
+//every `/`. Rounding halves is away from zero.
+var rounding = map[string]func(x, y int) int{
+	"floor": floorDiv,
+	"ceil":  ceilDiv,
+	"round": roundDiv,
+}
+
+//floorDiv is x/y rounded down. Dividing whole numbers rather than floats keeps large quotients exact.
+func floorDiv(x, y int) int {
+	q := x / y
+	if x%y != 0 && (x < 0) != (y < 0) {
+		q--
+	}
+	return q
+}
+
+//ceilDiv is x/y rounded up.
+func ceilDiv(x, y int) int {
+	q := x / y
+	if x%y != 0 && (x < 0) == (y < 0) {
+		q++
+	}
+	return q
+}
+
+//roundDiv is x/y rounded to the nearest whole number, halves away from zero.
+func roundDiv(x, y int) int {
+	q, r := x/y, x%y
+	if r != 0 && 2*magnitude(r) >= magnitude(y) {
+		if (x < 0) == (y < 0) {
+			q++
+		} else {
+			q--
+		}
+	}
+	return q
+}
+
+//magnitude is the absolute value of v, which is exact for math.MinInt too.
+func magnitude(v int) uint {
+	if v < 0 {
+		return uint(-v)
+	}
+	return uint(v)
+}
+
+//abs is the absolute value of v, false for math.MinInt whose absolute value overflows.
+func abs(v int) (int, bool) {
+	if v < 0 {
+		return neg(v)
+	}
+	return v, true
+}
+
+//clamp limits v to the range lo to hi.
+func clamp(v int, lo int, hi int) int {
+	if v < lo {
+		v = lo
+	}
+	if v > hi {
+		v = hi
+	}
+	return v
+}
+
+//call is the node calling the builtin name with args, nil when name isn't a builtin.
+func call(name string, args []*node) (*node, error) {
+	b, ok := builtins[name]
+	if !ok {
+		return nil, nil
+	}
+	if b.args < 0 && len(args) < 1 {
+		return nil, parseError(ErrorArguments, "parse error: %s takes at least 1 arguments, got %d", name, len(args))
+	}
+	if b.args >= 0 && len(args) != b.args {
+		return nil, parseError(ErrorArguments, "parse error: %s takes %d arguments, got %d", name, b.args, len(args))
+	}
+	return &node{kind: NodeTypeFunction, operator: name, operands: args}, nil
+}
+
+//isRounding is true of the rounding functions `floor`, `ceil` and `round`, which round the exact value of their
+//argument rather than its truncated total, so `ceil(d%/10)` and `round(d6/4*3)` keep the fractions they round.
+func (n *node) isRounding() bool {
+	_, ok := rounding[n.operator]
+	return n.kind == NodeTypeFunction && ok
+}
+
+//roundFraction rounds the exact value q as the rounding function name does, false when the result overflows an int.
+func roundFraction(name string, q *big.Rat) (int, bool) {
+	num, den := q.Num(), q.Denom()
+	r := new(big.Int)
+	switch name {
+	case "floor":
+		//the denominator is positive, so Euclidean division rounds down
+		r.Div(num, den)
+	case "ceil":
+		r.Neg(r.Div(new(big.Int).Neg(num), den))
+	default:
+		//|q|+1/2 rounded down, with the sign of q
+		twice := new(big.Int).Mul(new(big.Int).Abs(num), big.NewInt(2))
+		r.Div(twice.Add(twice, den), new(big.Int).Mul(den, big.NewInt(2)))
+		if num.Sign() < 0 {
+			r.Neg(r)
+		}
+	}
+	if !r.IsInt64() || int64(int(r.Int64())) != r.Int64() {
+		return 0, false
+	}
+	return int(r.Int64()), true
+}
+
+//evalFunction applies the builtin to its evaluated arguments.
+func (n *rolled) evalFunction(r Source) (int, []int, error) {
+	values := make([]int, len(n.operands))
+	for i, o := range n.operands {
+		v, _, err := o.evaluate(r)
+		if err != nil {
+			return 0, []int{}, err
+		}
+		values[i] = v
+	}
+	v, ok := builtins[n.operator].apply(values)
+	if n.isRounding() {
+		v, ok = roundFraction(n.operator, n.operands[0].Fraction())
+	}
+	if !ok {
+		return 0, []int{}, n.overflow()
+	}
+	n.v = v
+	n.vs = []int{n.v}
+	return n.v, n.vs, nil
+}
+
+//functionDistribution combines the distributions of the builtin's arguments.
+func (n *node) functionDistribution(env Environment) (Distribution, error) {
+	if n.isRounding() {
+		fd, err := n.operands[0].fractionDistribution(env)
+		if err != nil {
+			return nil, err
+		}
+		d := Distribution{}
+		for _, f := range fd {
+			v, ok := roundFraction(n.operator, f.v)
+			if !ok {
+				return nil, ErrOverflow
+			}
+			d[v] += f.p
+		}
+		return d, nil
+	}
+	return n.joint(n.operands, env, builtins[n.operator].apply)
+}
+
+func (n *rolled) planOfFunction() string {
+	s := make([]string, len(n.operands))
+	for i, o := range n.operands {
+		s[i] = o.Plan()
+	}
+	return fmt.Sprintf("%s(%s %v)", n.operator, strings.Join(s, ","), n.vs)
+}
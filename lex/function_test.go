@@ -0,0 +1,68 @@
+package lex
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_builtins(t *testing.T) {
+	tests := map[string]int{
+		"max(1, 3-5)":        1,
+		"min(4,2,3)":         2,
+		"abs(2-7)":           5,
+		"floor(-7/2)":        -4,
+		"ceil(7/2)":          4,
+		"ceil(-7/2)":         -3,
+		"round(7/2)":         4,
+		"round(-7/2)":        -4,
+		"round(5/3)":         2,
+		"floor(2*3)":         6,
+		"clamp(12, 1, 10)":   10,
+		"clamp(-2, 1, 10)":   1,
+		"max(d6-6, 1)":       1,
+		"2*abs(-(1d1))":      2,
+		"ceil(15/10+1)":      3,
+		"round(7/4*3)":       5,
+		"floor(-(7/2))":      -4,
+		"ceil((1/3,1/3))":    1,
+		"round(1/2+1/2)":     1,
+		"floor(ceil(7/2)/3)": 1,
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		e, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		if err != nil || e.Total() != expected {
+			t.Errorf("ERROR %v\texpected\t%d\tgot\t%v %v", test, expected, e, err)
+		} else {
+			t.Logf("OK    %v\t%s", test, e.Plan())
+		}
+	}
+}
+
+func Test_builtin_errors(t *testing.T) {
+	tests := map[string]string{
+		"max":          "parse error: max takes at least 1 arguments, got 0",
+		"min()":        "parse error: min takes at least 1 arguments, got 0",
+		"abs(1,2)":     "parse error: abs takes 1 arguments, got 2",
+		"clamp(1,2)":   "parse error: clamp takes 3 arguments, got 2",
+		"ceil(d6/0)":   "divide by zero in ((1d6)/0)",
+		"max(1,@none)": "unbound variable @none",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err == nil {
+			_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		}
+		if err == nil || err.Error() != expected {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, err)
+		}
+	}
+	if err := (Macros{}).Define("max(x) = x"); err == nil || err.Error() != "max is a builtin function" {
+		t.Errorf("ERROR max(x) = x expected builtin error got %v", err)
+	}
+}
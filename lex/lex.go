@@ -11,10 +11,16 @@ type Lexer interface {
 }
 
 func NewLexer(in io.Reader) Lexer {
+	return newLexer(in, nil)
+}
+
+//newLexer is a lexer reading the names of the dice as named dice, such as the `dAvg` of `2dAvg`.
+func newLexer(in io.Reader, dice NamedDice) *lexer {
 	return &lexer{
-		buf: make([]byte, 1, 1),
-		in:  in,
-		pos: -1,
+		buf:  make([]byte, 1, 1),
+		in:   in,
+		pos:  -1,
+		dice: dice,
 	}
 }
 
@@ -22,14 +28,29 @@ type lexer struct {
 	in    io.Reader
 	model AST
 	token *Token
+	last  TokenType
 	buf   []byte
 	pos   int
+	dice  NamedDice
+	//start is the offset of the first byte of the token being read.
+	start int
+	//err is the error which ended lexing.
+	err error
 }
 
 func (l *lexer) byte() byte {
 	return l.buf[0]
 }
 
+//operandEnded is true when the last token completed an operand, so the next operator is infix or postfix.
+func (l *lexer) operandEnded() bool {
+	switch l.last {
+	case TokenLiteral, TokenVariable, TokenIdentifier, TokenCloseParen, TokenPostfixOperator:
+		return true
+	}
+	return false
+}
+
 func (l *lexer) next() error {
 	var n int
 	var err error
@@ -46,6 +67,7 @@ func (l *lexer) Lex(receiver TokenReceiver) {
 	emitter := func(t *Token) {
 		if t != nil {
 			receiver(*t)
+			l.last = t.Kind
 		}
 	}
 	for state := advanceOneByte; state != nil; state = state(l) {
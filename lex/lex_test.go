@@ -61,13 +61,208 @@ func Test_lexer(t *testing.T) {
 			{Kind: TokenPostfixOperator, Value: "!"},
 			{Kind: TokenEndOfStream},
 		},
-		"fdx-2": {
-			{Kind: TokenError, Value: "unhandled char: f @ offset 0"},
+		"-2+d6*-1": {
+			{Kind: TokenPrefixOperator, Value: "-"},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenInfixOperator, Value: "*"},
+			{Kind: TokenPrefixOperator, Value: "-"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenEndOfStream},
+		},
+		"2d6 < 7 && d6>=4": {
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenComparison, Value: "<"},
+			{Kind: TokenLiteral, Value: "7"},
+			{Kind: TokenInfixOperator, Value: "&&"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenComparison, Value: ">="},
+			{Kind: TokenLiteral, Value: "4"},
+			{Kind: TokenEndOfStream},
+		},
+		"d20+@str_mod-@Prof2": {
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "20"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenVariable, Value: "str_mod"},
+			{Kind: TokenInfixOperator, Value: "-"},
+			{Kind: TokenVariable, Value: "Prof2"},
+			{Kind: TokenEndOfStream},
+		},
+		"1+@-2": {
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenError, Value: "unhandled char: @ @ offset 2"},
+		},
+		"1&2": {
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenError, Value: "parse error: expected &&"},
+		},
+		"d10!!>=9": {
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "10"},
+			{Kind: TokenInfixOperator, Value: "!!"},
+			{Kind: TokenPrefixOperator, Value: ">="},
+			{Kind: TokenLiteral, Value: "9"},
+			{Kind: TokenEndOfStream},
+		},
+		"d6!p+1": {
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenPostfixOperator, Value: "!p"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenEndOfStream},
+		},
+		"d6,2d8": {
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenSeparator, Value: ","},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "8"},
+			{Kind: TokenEndOfStream},
+		},
+		"d8w+2": {
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "8"},
+			{Kind: TokenPostfixOperator, Value: "w"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenEndOfStream},
+		},
+		"1wd%,2w(d8)": {
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenInfixOperator, Value: "w"},
+			{Kind: TokenPostfixOperator, Value: "d%"},
+			{Kind: TokenSeparator, Value: ","},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "w"},
+			{Kind: TokenOpenParen, Value: "("},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "8"},
+			{Kind: TokenCloseParen, Value: ")"},
+			{Kind: TokenEndOfStream},
+		},
+		"4d6kh3+2d20kl": {
+			{Kind: TokenLiteral, Value: "4"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenInfixOperator, Value: "kh"},
+			{Kind: TokenLiteral, Value: "3"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "20"},
+			{Kind: TokenPostfixOperator, Value: "kl"},
+			{Kind: TokenEndOfStream},
+		},
+		"4d6dl1,2d6dh": {
+			{Kind: TokenLiteral, Value: "4"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenInfixOperator, Value: "dl"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenSeparator, Value: ","},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenPostfixOperator, Value: "dh"},
+			{Kind: TokenEndOfStream},
+		},
+		"4d6kx": {
+			{Kind: TokenLiteral, Value: "4"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenError, Value: "unhandled char: x @ offset 4"},
+		},
+		"2d6ro<=3+d6r1": {
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenInfixOperator, Value: "ro"},
+			{Kind: TokenPrefixOperator, Value: "<="},
+			{Kind: TokenLiteral, Value: "3"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "6"},
+			{Kind: TokenInfixOperator, Value: "r"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenEndOfStream},
+		},
+		"8d10#>=7f1": {
+			{Kind: TokenLiteral, Value: "8"},
+			{Kind: TokenInfixOperator, Value: "d"},
+			{Kind: TokenLiteral, Value: "10"},
+			{Kind: TokenInfixOperator, Value: "#>="},
+			{Kind: TokenLiteral, Value: "7"},
+			{Kind: TokenInfixOperator, Value: "f"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenEndOfStream},
+		},
+		"?dx-2": {
+			{Kind: TokenError, Value: "unhandled char: ? @ offset 0"},
 		},
 		"3dx-2": {
 			{Kind: TokenLiteral, Value: "3"},
 			{Kind: TokenInfixOperator, Value: "d"},
-			{Kind: TokenError, Value: "unhandled char: x @ offset 2"},
+			{Kind: TokenIdentifier, Value: "x"},
+			{Kind: TokenInfixOperator, Value: "-"},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenEndOfStream},
+		},
+		"fireball+adv(d%,dF)+dfoo": {
+			{Kind: TokenIdentifier, Value: "fireball"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenIdentifier, Value: "adv"},
+			{Kind: TokenOpenParen, Value: "("},
+			{Kind: TokenPostfixOperator, Value: "d%"},
+			{Kind: TokenSeparator, Value: ","},
+			{Kind: TokenPostfixOperator, Value: "dF"},
+			{Kind: TokenCloseParen, Value: ")"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenIdentifier, Value: "dfoo"},
+			{Kind: TokenEndOfStream},
+		},
+		"2d{1, -1,0}+d{2,4}!,4dFkh3": {
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenPostfixOperator, Value: "d{1,-1,0}"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenPostfixOperator, Value: "d{2,4}"},
+			{Kind: TokenPostfixOperator, Value: "!"},
+			{Kind: TokenSeparator, Value: ","},
+			{Kind: TokenLiteral, Value: "4"},
+			{Kind: TokenPostfixOperator, Value: "dF"},
+			{Kind: TokenInfixOperator, Value: "kh"},
+			{Kind: TokenLiteral, Value: "3"},
+			{Kind: TokenEndOfStream},
+		},
+		"dForce+2dFkh1": {
+			{Kind: TokenPostfixOperator, Value: "dForce"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenPostfixOperator, Value: "dF"},
+			{Kind: TokenInfixOperator, Value: "kh"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenEndOfStream},
+		},
+		"d{1,x}": {
+			{Kind: TokenError, Value: "unhandled char: x @ offset 4"},
+		},
+		"2d{1,2": {
+			{Kind: TokenLiteral, Value: "2"},
+			{Kind: TokenError, Value: "unterminated faces: d{1,2"},
+		},
+		"dX+1": {
+			{Kind: TokenPostfixOperator, Value: "dX"},
+			{Kind: TokenInfixOperator, Value: "+"},
+			{Kind: TokenLiteral, Value: "1"},
+			{Kind: TokenEndOfStream},
 		},
 		"1d6%2": {
 			{Kind: TokenLiteral, Value: "1"},
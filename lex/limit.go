@@ -0,0 +1,174 @@
+package lex
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+//Limits bound the work of parsing and evaluating an expression, such as one typed by the users of a public bot.
+//A limit of zero is no limit, except that an evaluation or distribution never rolls more than maxDice dice.
+type Limits struct {
+	//Dice is the most dice an evaluation may roll, counting rerolled and bonus dice, or a distribution may sum.
+	Dice int
+	//Sides is the most sides a die may have.
+	Sides int
+	//Length is the longest expression a parser reads, in bytes.
+	Length int
+	//Depth is the deepest a parsed AST may nest its nodes, once its macros are expanded.
+	Depth int
+	//Time is the longest an evaluation, or a distribution, may take.
+	Time time.Duration
+}
+
+//Limit identifies one of the Limits.
+type Limit byte
+
+const (
+	//LimitDice is Limits.Dice.
+	LimitDice Limit = iota
+	//LimitSides is Limits.Sides.
+	LimitSides
+	//LimitLength is Limits.Length.
+	LimitLength
+	//LimitDepth is Limits.Depth.
+	LimitDepth
+	//LimitTime is Limits.Time.
+	LimitTime
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitDice:
+		return "dice"
+	case LimitSides:
+		return "sides"
+	case LimitLength:
+		return "length"
+	case LimitDepth:
+		return "depth"
+	default:
+		return "time"
+	}
+}
+
+//LimitError reports an expression exceeding one of its Limits.
+type LimitError struct {
+	Limit Limit
+	//Max is the value of the limit exceeded, a time.Duration for LimitTime.
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitDice:
+		return fmt.Sprintf("limit exceeded: more than %d dice", e.Max)
+	case LimitSides:
+		return fmt.Sprintf("limit exceeded: a die of more than %d sides", e.Max)
+	case LimitLength:
+		return fmt.Sprintf("limit exceeded: expression longer than %d bytes", e.Max)
+	case LimitDepth:
+		return fmt.Sprintf("limit exceeded: expression nested deeper than %d levels", e.Max)
+	default:
+		return fmt.Sprintf("limit exceeded: evaluation took longer than %v", time.Duration(e.Max))
+	}
+}
+
+//checkDice fails when count dice are more than the limit, or maxDice without a limit.
+func (l Limits) checkDice(count int) error {
+	max := l.Dice
+	if max <= 0 {
+		max = maxDice
+	}
+	if count > max {
+		return &LimitError{Limit: LimitDice, Max: int64(max)}
+	}
+	return nil
+}
+
+//checkSides fails when a die of sides sides has more than the limit.
+func (l Limits) checkSides(sides int) error {
+	if l.Sides > 0 && sides > l.Sides {
+		return &LimitError{Limit: LimitSides, Max: int64(l.Sides)}
+	}
+	return nil
+}
+
+//checkDepth fails when the AST n nests deeper than the limit.
+func (l Limits) checkDepth(n *node) error {
+	if l.Depth > 0 && n.depth() > l.Depth {
+		return &LimitError{Limit: LimitDepth, Max: int64(l.Depth)}
+	}
+	return nil
+}
+
+//depth is the number of nodes on the longest path from the node to a leaf.
+func (n *node) depth() int {
+	if n == nil {
+		return 0
+	}
+	deepest := 0
+	for _, o := range append([]*node{n.operand1, n.operand2}, n.operands...) {
+		if d := o.depth(); d > deepest {
+			deepest = d
+		}
+	}
+	return deepest + 1
+}
+
+//maxDice is the most dice an evaluation rolls without a dice limit, so no expression can exhaust memory.
+const maxDice = 1000000
+
+//budget counts the dice rolled by an evaluation and the time it has taken against its limits.
+type budget struct {
+	limits   Limits
+	dice     int
+	deadline time.Time
+}
+
+func newBudget(limits Limits) *budget {
+	b := &budget{limits: limits}
+	if limits.Time > 0 {
+		b.deadline = time.Now().Add(limits.Time)
+	}
+	return b
+}
+
+//roll counts count more dice, failing once the evaluation has rolled too many dice or run out of time.
+func (b *budget) roll(count int) error {
+	max := b.limits.Dice
+	if max <= 0 {
+		max = maxDice
+	}
+	if count > max-b.dice {
+		return &LimitError{Limit: LimitDice, Max: int64(max)}
+	}
+	b.dice += count
+	return b.timeout()
+}
+
+//timeout fails once the evaluation has run out of time.
+func (b *budget) timeout() error {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return &LimitError{Limit: LimitTime, Max: int64(b.limits.Time)}
+	}
+	return nil
+}
+
+//limitedReader reads an expression, failing once it is longer than max bytes.
+type limitedReader struct {
+	in   io.Reader
+	max  int
+	read int
+	err  error
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	n, err := r.in.Read(b)
+	r.read += n
+	if r.max > 0 && r.read > r.max {
+		r.err = &LimitError{Limit: LimitLength, Max: int64(r.max)}
+		return 0, r.err
+	}
+	return n, err
+}
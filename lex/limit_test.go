@@ -0,0 +1,167 @@
+package lex
+
+import (
+	"errors"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_limits(t *testing.T) {
+	limits := Limits{Dice: 100, Sides: 1000, Length: 40, Depth: 8}
+	tests := map[string]struct {
+		limit Limit
+		ok    bool
+	}{
+		"999999999d999999999":   {limit: LimitSides},
+		"999999999d6":           {limit: LimitDice},
+		"100d6":                 {ok: true},
+		"50d6+51d6":             {limit: LimitDice},
+		"50d6!":                 {ok: true},
+		"100d6r<6":              {limit: LimitDice},
+		"d1000+d%":              {ok: true},
+		"d1001":                 {limit: LimitSides},
+		"1+2+3+4+5+6+7":         {ok: true},
+		"1+2+3+4+5+6+7+8+9":     {limit: LimitDepth},
+		"((((((((((1))))))))))": {ok: true},
+		"1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1+1": {limit: LimitLength},
+	}
+	for test, expected := range tests {
+		ast, err := NewParserWithLimits(strings.NewReader(test), nil, nil, limits).Parse()
+		if err == nil {
+			_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{Limits: limits})
+		}
+		var limitErr *LimitError
+		switch {
+		case expected.ok && err != nil:
+			t.Errorf("ERROR %v\texpected\tno error\tgot\t%v", test, err)
+		case !expected.ok && (!errors.As(err, &limitErr) || limitErr.Limit != expected.limit):
+			t.Errorf("ERROR %v\texpected\tlimit %v\tgot\t%v", test, expected.limit, err)
+		default:
+			t.Logf("OK %48v %v", test, err)
+		}
+	}
+}
+
+func Test_limits_distribution(t *testing.T) {
+	limits := Limits{Dice: 10, Sides: 20}
+	tests := map[string]Limit{
+		"11d6":       LimitDice,
+		"d21":        LimitSides,
+		"1b(d4,d30)": LimitSides,
+		"(d12)d6":    LimitDice,
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		var limitErr *LimitError
+		if _, err := ast.Distribution(Environment{Limits: limits}); !errors.As(err, &limitErr) || limitErr.Limit != expected {
+			t.Errorf("ERROR %v\texpected\tlimit %v\tgot\t%v", test, expected, err)
+		}
+	}
+}
+
+func Test_limit_time(t *testing.T) {
+	ast, err := NewParser(strings.NewReader("1000000d6")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{Limits: Limits{Time: time.Nanosecond}})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitTime {
+		t.Errorf("ERROR expected time limit got %v", err)
+	}
+	if err.Error() != "limit exceeded: evaluation took longer than 1ns" {
+		t.Error("ERROR", err)
+	}
+}
+
+func Test_default_dice_limit(t *testing.T) {
+	tests := map[string]Limits{
+		"9223372036854775807d1":   {},
+		"999999999d999999999":     {},
+		"999999999d6":             {Time: time.Minute},
+		"600000d6+600000d6":       {},
+		"9223372036854775807d1+1": {Time: time.Minute},
+	}
+	for test, limits := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{Limits: limits})
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != LimitDice || limitErr.Max != maxDice {
+			t.Errorf("ERROR %v\texpected\tlimit of %d dice\tgot\t%v", test, maxDice, err)
+		}
+	}
+}
+
+func Test_evaluate_all_limits(t *testing.T) {
+	asts, err := NewParser(strings.NewReader("400d6,400d6,400d6")).ParseAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{Limits: Limits{Dice: 1000}}
+	var limitErr *LimitError
+	if _, err := EvaluateAll(asts, rand.New(rand.NewSource(11)), env); !errors.As(err, &limitErr) || limitErr.Limit != LimitDice {
+		t.Error("ERROR expected the expressions to roll too many dice together got", err)
+	}
+	evaluations, err := EvaluateAll(asts[:2], rand.New(rand.NewSource(11)), env)
+	if err != nil || len(evaluations) != 2 {
+		t.Fatal("ERROR expected two evaluations got", evaluations, err)
+	}
+	if _, err := asts[0].Evaluate(rand.New(rand.NewSource(11)), env); err != nil {
+		t.Error("ERROR expected an evaluation of its own to have a budget of its own got", err)
+	}
+}
+
+func Test_large_numbered_dice(t *testing.T) {
+	for _, test := range []string{"d100000000!", "d999999999!", "d999999999r1", "d999999999ro<3", "d999999999#>3", "d999999999w"} {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			t.Error("ERROR", test, err)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("ERROR %v\tallocated %d bytes", test, allocated)
+		}
+	}
+	for test, expected := range map[string]string{
+		"d999999999r<1000000000": "((1d999999999)r(<1000000000)) - every face would be rerolled",
+		"d999999999!>=1":         "((1d999999999)!(>=1)) - every face would explode",
+		"d1!":                    "((1d1)!) - every face would explode",
+	} {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err == nil {
+			_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		}
+		if err == nil || err.Error() != expected {
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected, err)
+		}
+	}
+}
+
+func Test_limit_time_distribution(t *testing.T) {
+	limits := Limits{Dice: 1000, Sides: 1000, Time: 10 * time.Millisecond}
+	for _, test := range []string{"20d20d20", "dAbilityd%d%", "100d6kh50"} {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		var limitErr *LimitError
+		if _, err := ast.Distribution(Environment{Limits: limits}); !errors.As(err, &limitErr) || limitErr.Limit != LimitTime {
+			t.Errorf("ERROR %v\texpected\ttime limit\tgot\t%v", test, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package lex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//Macro is a named expression, such as `fireball = 8d6`, or a function of its parameters, such as
+//`adv(x) = 1b(2d20)+x`. Wherever its name is used the macro's body is expanded into the AST.
+type Macro struct {
+	Name   string
+	Params []string
+	Body   AST
+}
+
+func (m *Macro) String() string {
+	if len(m.Params) == 0 {
+		return fmt.Sprintf("%s = %v", m.Name, m.Body)
+	}
+	return fmt.Sprintf("%s(%s) = %v", m.Name, strings.Join(m.Params, ","), m.Body)
+}
+
+//Macros are the macros known to a parser, by name.
+type Macros map[string]*Macro
+
+var definition = regexp.MustCompile(`^\s*(\w+)\s*(?:\(([^()]*)\))?\s*=([^=].*)$`)
+
+//Define adds the macro defined by definition, such as `fireball = 8d6` or `adv(x) = 1b(2d20)+x`.
+//The body may use the macros already defined, which are expanded into it, replacing them later has no effect on it.
+func (m Macros) Define(definition string) error {
+	return m.DefineWithDice(definition, nil)
+}
+
+//DefineWithDice adds the macro defined by definition, whose body may roll the named dice.
+func (m Macros) DefineWithDice(definition string, dice NamedDice) error {
+	name, params, body, ok := splitDefinition(definition)
+	if !ok {
+		return fmt.Errorf("not a macro definition: %s", definition)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("%s is a builtin function", name)
+	}
+	p := NewParserWithDice(strings.NewReader(body), m, dice).(*parser)
+	p.params = params
+	ast, err := p.Parse()
+	if err != nil {
+		return err
+	}
+	if ast.(*node) == nil {
+		return fmt.Errorf("macro %s has no body", name)
+	}
+	m[name] = &Macro{Name: name, Params: params, Body: ast}
+	return nil
+}
+
+func splitDefinition(line string) (name string, params []string, body string, ok bool) {
+	match := definition.FindStringSubmatch(line)
+	if match == nil || !isName(match[1]) {
+		return "", nil, "", false
+	}
+	if strings.TrimSpace(match[2]) != "" {
+		for _, param := range strings.Split(match[2], ",") {
+			param = strings.TrimSpace(param)
+			if !isName(param) {
+				return "", nil, "", false
+			}
+			params = append(params, param)
+		}
+	}
+	return match[1], params, match[3], true
+}
+
+//isName is true of the names the lexer reads as a single identifier: not starting with a digit, a word operator
+//or a named die.
+func isName(name string) bool {
+	letters := 0
+	for letters < len(name) && isLetter(name[letters]) {
+		letters++
+	}
+	_, operator := wordOperators[name[:letters]]
+	namedDie := len(name) > 1 && name[0] == 'd' && isCapital(name[1])
+	return letters > 0 && !operator && !namedDie
+}
+
+//expand copies the macro body n, replacing its parameters with copies of their arguments.
+func (n *node) expand(args map[string]*node) *node {
+	if n == nil {
+		return nil
+	}
+	if arg, ok := args[n.param]; ok && n.param != "" {
+		return arg.expand(nil)
+	}
+	c := *n
+	c.operand1 = n.operand1.expand(args)
+	c.operand2 = n.operand2.expand(args)
+	if n.operands != nil {
+		c.operands = make([]*node, len(n.operands))
+		for i, o := range n.operands {
+			c.operands[i] = o.expand(args)
+		}
+	}
+	return &c
+}
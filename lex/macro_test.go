@@ -0,0 +1,85 @@
+package lex
+
+import (
+	"strings"
+	"testing"
+)
+
+func testMacros(t *testing.T) Macros {
+	macros := Macros{}
+	for _, definition := range []string{
+		"fireball = 8d6",
+		"adv(x) = 1b(2d20)+x",
+		"times(x, y) = x*y",
+		"zero() = 0",
+		"blast = fireball+adv(2)",
+	} {
+		if err := macros.Define(definition); err != nil {
+			t.Fatal("ERROR", definition, err)
+		}
+	}
+	return macros
+}
+
+func Test_macro_expansion(t *testing.T) {
+	tests := map[string]string{
+		"fireball+2":    "((8d6)+2)",
+		"adv(3)":        "((1b(2d20))+3)",
+		"adv(fireball)": "((1b(2d20))+(8d6))",
+		"times(2,d6)":   "(2*(1d6))",
+		"zero()+zero":   "(0+0)",
+		"blast":         "((8d6)+((1b(2d20))+2))",
+		"1b(adv(1),d6)": "(1b(((1b(2d20))+1),(1d6)))",
+		"adv(1) >= 15":  "(((1b(2d20))+1) >= 15)",
+		"fireball = 24": "((8d6) = 24)",
+	}
+	macros := testMacros(t)
+	for test, expected := range tests {
+		ast, err := NewParserWithMacros(strings.NewReader(test), macros).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		if ast.String() != expected {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, ast)
+		} else {
+			t.Logf("OK    %v\t%v", test, ast)
+		}
+	}
+}
+
+func Test_macro_errors(t *testing.T) {
+	tests := map[string]string{
+		"adv":         "parse error: adv takes 1 arguments, got 0",
+		"adv(1,2)":    "parse error: adv takes 1 arguments, got 2",
+		"zero(1)":     "parse error: zero takes 0 arguments, got 1",
+		"lightning":   "parse error: unknown macro lightning",
+		"3 lightning": "parse error: 3 lightning",
+	}
+	macros := testMacros(t)
+	for test, expected := range tests {
+		_, err := NewParserWithMacros(strings.NewReader(test), macros).Parse()
+		if err == nil || err.Error() != expected {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, err)
+		}
+	}
+}
+
+func Test_define(t *testing.T) {
+	tests := map[string]string{
+		"fireball = 8d6":        "",
+		"adv( x ) = 1b(2d20)+x": "",
+		"d = 3":                 "not a macro definition: d = 3",
+		"d20 = 3":               "not a macro definition: d20 = 3",
+		"x <= 3":                "not a macro definition: x <= 3",
+		"x == 3":                "not a macro definition: x == 3",
+		"x(y) = y+z":            "parse error: unknown macro z",
+		"x = ":                  "macro x has no body",
+	}
+	for test, expected := range tests {
+		err := Macros{}.Define(test)
+		if expected == "" && err != nil || expected != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package lex
+
+import (
+	"fmt"
+)
+
+//comparators test a rolled value against a threshold.
+var comparators = map[string]func(v, threshold int) bool{
+	"<":  func(v, threshold int) bool { return v < threshold },
+	"<=": func(v, threshold int) bool { return v <= threshold },
+	">":  func(v, threshold int) bool { return v > threshold },
+	">=": func(v, threshold int) bool { return v >= threshold },
+	"=":  func(v, threshold int) bool { return v == threshold },
+}
+
+//condition selects the dice a modifier applies to, such as the `<3` of `2d6ro<3`.
+type condition struct {
+	comparator string
+	threshold  int
+}
+
+func (c condition) match(v int) bool {
+	return comparators[c.comparator](v, c.threshold)
+}
+
+//matchesAll is true when every face of the die d matches. Every comparator matches a range of values, so a
+//numbered die's faces all match when its lowest and highest do.
+func (c condition) matchesAll(d dieType) bool {
+	if d.faces == nil {
+		return c.match(d.lowest()) && c.match(d.highest())
+	}
+	for _, f := range d.faces {
+		if !c.match(f) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) String() string {
+	return fmt.Sprintf("%s%d", c.comparator, c.threshold)
+}
+
+//isCondition is true of a prefix comparator such as `<3`.
+func (n *node) isCondition() bool {
+	_, ok := comparators[n.operator]
+	return n.kind == NodeTypePrefixOperator && ok
+}
+
+//condition is the modifier's condition given operand2 evaluated to threshold. A bare number is an `=` condition.
+func (n *node) condition(threshold int) condition {
+	if n.operand2.isCondition() {
+		return condition{comparator: n.operand2.operator, threshold: threshold}
+	}
+	return condition{comparator: "=", threshold: threshold}
+}
+
+//isDiceModifier is true of operators which modify the dice rolled by operand1.
+func (n *node) isDiceModifier() bool {
+	if n.kind != NodeTypeInfixOperator && n.kind != NodeTypePostfixOperator {
+		return false
+	}
+	switch n.operator {
+	case "!", "!!", "!p", "r", "ro", "kh", "kl", "dh", "dl":
+		return true
+	}
+	return false
+}
+
+//explodesApart is true when the dice of this node, or the dice it modifies, explode with `!` or `!p`, rolling each
+//bonus die as a value of its own.
+func (n *node) explodesApart() bool {
+	for o := n; o != nil && o.isDiceModifier(); o = o.operand1 {
+		if o.operator == "!" || o.operator == "!p" {
+			return true
+		}
+	}
+	return false
+}
+
+//isSuccessCount is true of an infix comparator counting the dice of operand1 which match it, such as `6d6#>4`.
+func (n *node) isSuccessCount() bool {
+	_, ok := comparators[n.operator]
+	return n.kind == NodeTypeInfixOperator && ok && !n.check
+}
+
+//evalReroll rerolls the dice of operand1 which match the condition, `r` until they don't match and `ro` once.
+func (n *rolled) evalReroll(r Source, right int) (int, []int, error) {
+	die, err := n.diceType("reroll")
+	if err != nil {
+		return 0, []int{}, err
+	}
+	c := n.condition(right)
+	once := n.operator == "ro"
+	if !once && c.matchesAll(die) {
+		return 0, []int{}, fmt.Errorf("%v - every face would be rerolled", n)
+	}
+	n.vs = []int{}
+	n.dice = []Die{}
+	for _, v := range n.operand1.vs {
+		for c.match(v) {
+			n.dice = append(n.dice, Die{Sides: die.sides, Value: v, Rerolled: true})
+			if v, err = n.roll(r, die); err != nil {
+				return 0, []int{}, err
+			}
+			if once {
+				break
+			}
+		}
+		n.dice = append(n.dice, Die{Sides: die.sides, Value: v})
+		n.vs = append(n.vs, v)
+	}
+	if n.v, err = n.sum(n.vs); err != nil {
+		return 0, []int{}, err
+	}
+	return n.v, n.vs, nil
+}
+
+//evalSuccesses counts the dice of operand1 which match the comparator and threshold right.
+func (n *rolled) evalSuccesses(r Source, right int) (int, []int, error) {
+	if _, err := n.diceType("count successes of"); err != nil {
+		return 0, []int{}, err
+	}
+	c := condition{comparator: n.operator, threshold: right}
+	return n.count(n.operand1.dice, n.operand1.vs, c, func(d *Die) { d.Success = true }, 1)
+}
+
+//evalFailures subtracts the dice of the success count operand1 which match the failure condition.
+func (n *rolled) evalFailures(r Source, right int) (int, []int, error) {
+	if !n.operand1.isSuccessCount() {
+		return 0, []int{}, fmt.Errorf("%v - can't count failures without counting successes", n)
+	}
+	c := n.condition(right)
+	successes := n.operand1.v
+	n.count(n.operand1.dice, n.operand1.operand1.vs, c, func(d *Die) { d.Failure = true }, -1)
+	n.v += successes
+	return n.v, n.vs, nil
+}
+
+//count scores each of values matching c, marking the matching dice. The matching values are the node's values.
+func (n *rolled) count(dice []Die, values []int, c condition, mark func(d *Die), score int) (int, []int, error) {
+	counted := countedDice(dice)
+	n.dice = make([]Die, len(dice))
+	copy(n.dice, dice)
+	n.v = 0
+	n.vs = []int{}
+	for i, v := range values {
+		if !c.match(v) {
+			continue
+		}
+		n.v += score
+		n.vs = append(n.vs, v)
+		if len(counted) == len(values) {
+			mark(&n.dice[counted[i]])
+		}
+	}
+	return n.v, n.vs, nil
+}
+
+//planOfCounts plans the values counted as successes or failures.
+func (n *rolled) planOfCounts() string {
+	if n.operator == "f" {
+		return fmt.Sprintf("failures %v", n.vs)
+	}
+	return fmt.Sprintf("successes %v", n.vs)
+}
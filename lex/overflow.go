@@ -0,0 +1,56 @@
+package lex
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+//ErrOverflow is wrapped by the errors of totals too large, or too small, for an int, such as `99999999999*99999999999`.
+var ErrOverflow = errors.New("integer overflow")
+
+//overflow is the error of the node's total overflowing.
+func (n *node) overflow() error {
+	return fmt.Errorf("%w in %v", ErrOverflow, n)
+}
+
+//add is x+y, false when the sum overflows.
+func add(x, y int) (int, bool) {
+	s := x + y
+	return s, (s > x) == (y > 0)
+}
+
+//sub is x-y, false when the difference overflows.
+func sub(x, y int) (int, bool) {
+	d := x - y
+	return d, (d < x) == (y > 0)
+}
+
+//mul is x*y, false when the product overflows.
+func mul(x, y int) (int, bool) {
+	if x == 0 || y == 0 {
+		return 0, true
+	}
+	if x == -1 && y == math.MinInt || y == -1 && x == math.MinInt {
+		return 0, false
+	}
+	p := x * y
+	return p, p/y == x
+}
+
+//neg is -x, false when the negation overflows.
+func neg(x int) (int, bool) {
+	return -x, x != math.MinInt
+}
+
+//sum totals values, failing when the total overflows.
+func (n *rolled) sum(values []int) (int, error) {
+	total := 0
+	for _, v := range values {
+		var ok bool
+		if total, ok = add(total, v); !ok {
+			return 0, n.overflow()
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,113 @@
+package lex
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_checked_arithmetic(t *testing.T) {
+	tests := map[string]struct {
+		fn   func(x, y int) (int, bool)
+		x, y int
+		v    int
+		ok   bool
+	}{
+		"add":              {fn: add, x: 2, y: -3, v: -1, ok: true},
+		"add max":          {fn: add, x: math.MaxInt, y: 1},
+		"add min":          {fn: add, x: math.MinInt, y: -1},
+		"sub":              {fn: sub, x: -2, y: 3, v: -5, ok: true},
+		"sub min":          {fn: sub, x: 0, y: math.MinInt},
+		"sub max":          {fn: sub, x: math.MaxInt, y: -1},
+		"mul":              {fn: mul, x: -4, y: 3, v: -12, ok: true},
+		"mul zero":         {fn: mul, x: math.MinInt, y: 0, v: 0, ok: true},
+		"mul large":        {fn: mul, x: 99999999999, y: 99999999999},
+		"mul min":          {fn: mul, x: math.MinInt, y: -1},
+		"mul min reversed": {fn: mul, x: -1, y: math.MinInt},
+	}
+	for test, expected := range tests {
+		if v, ok := expected.fn(expected.x, expected.y); ok != expected.ok || ok && v != expected.v {
+			t.Errorf("ERROR %v\texpected\t%d %v\tgot\t%d %v", test, expected.v, expected.ok, v, ok)
+		}
+	}
+	if _, ok := neg(math.MinInt); ok {
+		t.Error("ERROR expected negating math.MinInt to overflow")
+	}
+}
+
+func Test_overflow(t *testing.T) {
+	tests := map[string]string{
+		"99999999999*99999999999":         "integer overflow in (99999999999*99999999999)",
+		"9223372036854775807+1":           "integer overflow in (9223372036854775807+1)",
+		"-9223372036854775807-2":          "integer overflow in ((-9223372036854775807)-2)",
+		"(-9223372036854775807-1)/-1":     "integer overflow in (((-9223372036854775807)-1)/(-1))",
+		"-(-9223372036854775807-1)":       "integer overflow in (-((-9223372036854775807)-1))",
+		"9d4611686018427387904":           "integer overflow in (9d4611686018427387904)",
+		"(9223372036854775807,1)":         "integer overflow in (9223372036854775807,1)",
+		"2b(-2,9223372036854775807,1)":    "integer overflow in (2b((-2),9223372036854775807,1))",
+		"99999999999999999999":            "parse error: integer overflow in 99999999999999999999",
+		"floor(9223372036854775807/1)*2":  "integer overflow in (floor((9223372036854775807/1))*2)",
+		"ceil(9223372036854775807/2)+1":   "",
+		"round(-9223372036854775807/2)-1": "",
+		"abs(-9223372036854775807-1)":     "integer overflow in abs(((-9223372036854775807)-1))",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err == nil {
+			_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		}
+		switch {
+		case expected == "" && err != nil:
+			t.Errorf("ERROR %v\texpected\tno error\tgot\t%v", test, err)
+		case expected != "" && (!errors.Is(err, ErrOverflow) || err.Error() != expected):
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected, err)
+		}
+	}
+}
+
+func Test_distribution_overflow(t *testing.T) {
+	tests := map[string]string{
+		"9223372036854775807+d6":        "integer overflow in (9223372036854775807+(1d6))",
+		"(9223372036854775807,d6)":      "integer overflow in (9223372036854775807,(1d6))",
+		"2d{1,9223372036854775807}":     "integer overflow in (2d{1,9223372036854775807})",
+		"d{1,9223372036854775807}!":     "integer overflow in ((1d{1,9223372036854775807})!)",
+		"2d{1,9223372036854775807}kh2":  "integer overflow in ((2d{1,9223372036854775807})kh2)",
+		"-(d2-9223372036854775807-2)":   "integer overflow in (-(((1d2)-9223372036854775807)-2))",
+		"abs(d2-9223372036854775807-2)": "integer overflow in abs((((1d2)-9223372036854775807)-2))",
+		"abs(d2-9223372036854775807-1)": "",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err == nil {
+			_, err = ast.Distribution(Environment{})
+		}
+		switch {
+		case expected == "" && err != nil:
+			t.Errorf("ERROR %v\texpected\tno error\tgot\t%v", test, err)
+		case expected != "" && (!errors.Is(err, ErrOverflow) || err.Error() != expected):
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected, err)
+		}
+	}
+}
+
+func Test_rounding_large_quotients(t *testing.T) {
+	tests := map[string]int{
+		"floor(9223372036854775807/1)": math.MaxInt,
+		"ceil(9223372036854775807/2)":  math.MaxInt/2 + 1,
+		"round(-9007199254740993/2)":   -4503599627370497,
+		"floor(-7/2)":                  -4,
+		"ceil(-7/2)":                   -3,
+		"round(7/-2)":                  -4,
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		if v, err := total(ast, rand.New(rand.NewSource(11)), Environment{}); err != nil || v != expected {
+			t.Errorf("ERROR %v\texpected\t%d\tgot\t%d %v", test, expected, v, err)
+		}
+	}
+}
@@ -21,10 +21,27 @@ type parserTestCases map[string]parserResult
 
 func Test_parser(t *testing.T) {
 	testCases := parserTestCases{
-		"":   parserResult{},
-		"3":  parserResult{node: &node{kind: NodeTypeLeaf, v: 3}},
-		"34": parserResult{node: &node{kind: NodeTypeLeaf, v: 33}},
-		"z7": parserResult{err: errors.New("unhandled char: z @ offset 0")},
+		"":      parserResult{},
+		"3":     parserResult{node: &node{kind: NodeTypeLeaf, v: 3}},
+		"34":    parserResult{node: &node{kind: NodeTypeLeaf, v: 33}},
+		"z7":    parserResult{err: errors.New("parse error: unknown macro z7")},
+		"3z":    parserResult{err: errors.New("parse error: 3 z")},
+		"d6,d8": parserResult{err: errors.New("parse error: expected 1 expression, got 2")},
+		"(1d6":  parserResult{err: errors.New("parse error: unbalanced (")},
+		"1d6)":  parserResult{err: errors.New("parse error: unbalanced )")},
+		"(1+3)*7": parserResult{
+			node: &node{
+				kind:     NodeTypeInfixOperator,
+				operator: "*",
+				operand1: &node{
+					kind:     NodeTypeInfixOperator,
+					operator: "+",
+					operand1: &node{kind: NodeTypeLeaf, v: 1},
+					operand2: &node{kind: NodeTypeLeaf, v: 3},
+				},
+				operand2: &node{kind: NodeTypeLeaf, v: 7},
+			},
+		},
 		"3d6": parserResult{
 			node: &node{
 				kind:     NodeTypeInfixOperator,
@@ -65,6 +82,97 @@ func Test_parser(t *testing.T) {
 				},
 			},
 		},
+		"d8w+1": parserResult{
+			node: &node{
+				kind:     NodeTypeInfixOperator,
+				operator: "+",
+				operand1: &node{
+					kind:     NodeTypePostfixOperator,
+					operator: "w",
+					operand1: &node{
+						kind:     NodeTypeInfixOperator,
+						operator: "d",
+						operand1: &node{kind: NodeTypeLeaf, v: 1},
+						operand2: &node{kind: NodeTypeLeaf, v: 8},
+					},
+				},
+				operand2: &node{kind: NodeTypeLeaf, v: 1},
+			},
+		},
+		"4d6kh3+1": parserResult{
+			node: &node{
+				kind:     NodeTypeInfixOperator,
+				operator: "+",
+				operand1: &node{
+					kind:     NodeTypeInfixOperator,
+					operator: "kh",
+					operand1: &node{
+						kind:     NodeTypeInfixOperator,
+						operator: "d",
+						operand1: &node{kind: NodeTypeLeaf, v: 4},
+						operand2: &node{kind: NodeTypeLeaf, v: 6},
+					},
+					operand2: &node{kind: NodeTypeLeaf, v: 3},
+				},
+				operand2: &node{kind: NodeTypeLeaf, v: 1},
+			},
+		},
+		"2d20kl": parserResult{
+			node: &node{
+				kind:     NodeTypePostfixOperator,
+				operator: "kl",
+				operand1: &node{
+					kind:     NodeTypeInfixOperator,
+					operator: "d",
+					operand1: &node{kind: NodeTypeLeaf, v: 2},
+					operand2: &node{kind: NodeTypeLeaf, v: 20},
+				},
+			},
+		},
+		"2d6ro<3+1": parserResult{
+			node: &node{
+				kind:     NodeTypeInfixOperator,
+				operator: "+",
+				operand1: &node{
+					kind:     NodeTypeInfixOperator,
+					operator: "ro",
+					operand1: &node{
+						kind:     NodeTypeInfixOperator,
+						operator: "d",
+						operand1: &node{kind: NodeTypeLeaf, v: 2},
+						operand2: &node{kind: NodeTypeLeaf, v: 6},
+					},
+					operand2: &node{
+						kind:     NodeTypePrefixOperator,
+						operator: "<",
+						operand1: &node{kind: NodeTypeLeaf, v: 3},
+					},
+				},
+				operand2: &node{kind: NodeTypeLeaf, v: 1},
+			},
+		},
+		"6d6#>4f<2": parserResult{
+			node: &node{
+				kind:     NodeTypeInfixOperator,
+				operator: "f",
+				operand1: &node{
+					kind:     NodeTypeInfixOperator,
+					operator: ">",
+					operand1: &node{
+						kind:     NodeTypeInfixOperator,
+						operator: "d",
+						operand1: &node{kind: NodeTypeLeaf, v: 6},
+						operand2: &node{kind: NodeTypeLeaf, v: 6},
+					},
+					operand2: &node{kind: NodeTypeLeaf, v: 4},
+				},
+				operand2: &node{
+					kind:     NodeTypePrefixOperator,
+					operator: "<",
+					operand1: &node{kind: NodeTypeLeaf, v: 2},
+				},
+			},
+		},
 		"d%/2": parserResult{
 			node: &node{
 				kind:     NodeTypeInfixOperator,
@@ -125,6 +233,35 @@ func Test_parser(t *testing.T) {
 				},
 			},
 		},
+		"2w(d10,d4+1)": parserResult{
+			node: &node{
+				kind:     NodeTypeInfixOperator,
+				operator: "w",
+				operand1: &node{kind: NodeTypeLeaf, v: 2},
+				operand2: &node{
+					kind: NodeTypeGroup,
+					operands: []*node{
+						{
+							kind:     NodeTypeInfixOperator,
+							operator: "d",
+							operand1: &node{kind: NodeTypeLeaf, v: 1},
+							operand2: &node{kind: NodeTypeLeaf, v: 10},
+						},
+						{
+							kind:     NodeTypeInfixOperator,
+							operator: "+",
+							operand1: &node{
+								kind:     NodeTypeInfixOperator,
+								operator: "d",
+								operand1: &node{kind: NodeTypeLeaf, v: 1},
+								operand2: &node{kind: NodeTypeLeaf, v: 4},
+							},
+							operand2: &node{kind: NodeTypeLeaf, v: 1},
+						},
+					},
+				},
+			},
+		},
 		"1w3d6": parserResult{
 			node: &node{
 				kind:     NodeTypeInfixOperator,
@@ -142,6 +279,91 @@ func Test_parser(t *testing.T) {
 	runParserTestCases(testCases, t)
 }
 
+func Test_parser_negation(t *testing.T) {
+	tests := map[string]string{
+		"-2+d6":  "((-2)+(1d6))",
+		"d6*-1":  "((1d6)*(-1))",
+		"-(1d4)": "(-(1d4))",
+		"-2d6":   "(-(2d6))",
+		"-3b4d6": "(-(3b(4d6)))",
+		"2--3":   "(2-(-3))",
+		"-d6":    "(-(1d6))",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		if ast.String() != expected {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, ast)
+		} else {
+			t.Logf("OK    %v\t%v", test, ast)
+		}
+	}
+}
+
+func Test_parser_checks(t *testing.T) {
+	tests := map[string]string{
+		"d20+5 >= 15":         "(((1d20)+5) >= 15)",
+		"6d6#>4":              "((6d6)#>4)",
+		"(6d6)>4":             "((6d6) > 4)",
+		"dF >= 1":             "((1dF) >= 1)",
+		"d20+5>=15":           "(((1d20)+5) >= 15)",
+		"8d10!#>=7f1":         "((((8d10)!)#>=7)f1)",
+		"(2d6) < 7 || d6 = 6": "(((2d6) < 7)||((1d6) = 6))",
+		"1d20 >= 15":          "((1d20) >= 15)",
+		"d6 > 3 && d8 > 4":    "(((1d6) > 3)&&((1d8) > 4))",
+		"4d6 kh 3 >= 10":      "(((4d6)kh3) >= 10)",
+		"2d6ro <3 > 4":        "(((2d6)ro(<3)) > 4)",
+		" 1 + 2 ":             "(1+2)",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		if ast.String() != expected {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, ast)
+		} else {
+			t.Logf("OK    %v\t%v", test, ast)
+		}
+	}
+}
+
+func Test_parser_all(t *testing.T) {
+	tests := map[string][]string{
+		"d6":         {"(1d6)"},
+		"d6,d8":      {"(1d6)", "(1d8)"},
+		"1+2,3d6!,4": {"(1+2)", "((3d6)!)", "4"},
+		"(d6,d8),2":  {"((1d6),(1d8))", "2"},
+		"1b(d6,d8)":  {"(1b((1d6),(1d8)))"},
+	}
+	for test, expected := range tests {
+		asts, err := NewParser(strings.NewReader(test)).ParseAll()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		actual := make([]string, len(asts))
+		for i, ast := range asts {
+			actual[i] = ast.String()
+		}
+		if strings.Join(actual, " , ") != strings.Join(expected, " , ") {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, actual)
+			continue
+		}
+		t.Logf("OK %12v parsed as %v", test, actual)
+	}
+
+	for _, test := range []string{"d6,", ",d6", "d6,,d8", "(d6,)", "1b(d6,d8"} {
+		if _, err := NewParser(strings.NewReader(test)).ParseAll(); err == nil {
+			t.Error("ERROR", test, "expected", "error")
+		}
+	}
+}
+
 func runParserTestCases(tests parserTestCases, t *testing.T) {
 
 	size := len(tests)
@@ -192,6 +414,14 @@ func equal(m, n *node) bool {
 	if m == nil || n == nil {
 		return n == nil && m == nil
 	}
+	if len(n.operands) != len(m.operands) {
+		return false
+	}
+	for i := range n.operands {
+		if !equal(n.operands[i], m.operands[i]) {
+			return false
+		}
+	}
 	return n.kind == m.kind &&
 		strings.EqualFold(n.operator, m.operator) &&
 		equal(n.operand1, m.operand1) &&
@@ -5,38 +5,102 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 )
 
 type Parser interface {
 	Parse() (AST, error)
+	ParseAll() ([]AST, error)
 }
 
 var operatorPrecedence = map[string]byte{
-	"d": 4, "dF": 4, "d%": 4,
-	"!": 3,
-	"b": 2, "w": 2,
-	"*": 1, "/": 1,
-	"+": 0, "-": 0,
+	"d": 6, "dF": 6, "d%": 6,
+	"kh": 6, "kl": 6, "dh": 6, "dl": 6,
+	"r": 6, "ro": 6,
+	"!": 6, "!!": 6, "!p": 6,
+	"<": 6, "<=": 6, ">": 6, ">=": 6, "=": 6, "f": 6,
+	"b": 5, "w": 5,
+	"*": 4, "/": 4,
+	"+": 3, "-": 3,
+	"&&": 1,
+	"||": 0,
+}
+
+//prefixPrecedence is the precedence of prefix operators which differ from their infix namesakes.
+//Negation binds looser than dice and selections, so `-2d6` is `-(2d6)` and `-3b4d6` is `-(3b4d6)`.
+var prefixPrecedence = map[string]byte{
+	"-": 4,
+}
+
+//checkPrecedence is the precedence of comparisons, which check the totals of whole expressions.
+const checkPrecedence = 2
+
+//precedence is the precedence of the pending operator o.
+func precedence(o *node) byte {
+	if o.check {
+		return checkPrecedence
+	}
+	if p, ok := prefixPrecedence[o.operator]; ok && o.kind == NodeTypePrefixOperator {
+		return p
+	}
+	return operatorPrecedence[o.operator]
 }
 
 type parser struct {
-	l        Lexer
-	stack    []*node
-	registry map[TokenType]tokenProcessor
-	err      error
+	l             *lexer
+	stack         []*node
+	operators     []*node
+	exprs         []*node
+	expectOperand bool
+	registry      map[TokenType]tokenProcessor
+	err           error
+	macros        Macros
+	params        []string
+	identifier    string
+	dice          NamedDice
+	in            *limitedReader
+	limits        Limits
+	//identifierOffset is where the held identifier starts in the expression.
+	identifierOffset int
+	//separator is the first `,` separating independent expressions, locating the error of Parse reading several.
+	separator *Token
+	//parenthesised are the expressions closed in parentheses, so `(8d10)>=7` checks the total of the pool.
+	parenthesised map[*node]bool
 }
 
 func NewParser(in io.Reader) Parser {
-	p := &parser{l: NewLexer(in)}
+	return NewParserWithMacros(in, nil)
+}
+
+//NewParserWithMacros is a parser expanding the macros wherever their names are used.
+func NewParserWithMacros(in io.Reader, macros Macros) Parser {
+	return NewParserWithDice(in, macros, nil)
+}
+
+//NewParserWithDice is a parser expanding the macros and rolling the named dice, such as `2dAvg`,
+//wherever their names are used.
+func NewParserWithDice(in io.Reader, macros Macros, dice NamedDice) Parser {
+	return NewParserWithLimits(in, macros, dice, Limits{})
+}
+
+//NewParserWithLimits is a parser as NewParserWithDice failing on expressions longer or nested deeper than the limits.
+func NewParserWithLimits(in io.Reader, macros Macros, dice NamedDice, limits Limits) Parser {
+	limited := &limitedReader{in: in, max: limits.Length}
+	p := &parser{l: newLexer(limited, dice), expectOperand: true, macros: macros, dice: dice, in: limited, limits: limits,
+		parenthesised: map[*node]bool{}}
 	p.registry = map[TokenType]tokenProcessor{
-		TokenLiteral:         handleLiteral,
-		TokenEndOfStream:     handleEOS,
+		TokenLiteral:         p.handleLiteral,
+		TokenEndOfStream:     p.handleEOS,
 		TokenInfixOperator:   p.handleIFO,
 		TokenPostfixOperator: p.handlePos,
 		TokenPrefixOperator:  p.handlePre,
 		TokenOpenParen:       p.handleOP,
 		TokenCloseParen:      p.handleCP,
-		TokenError:           handleErr,
+		TokenSeparator:       p.handleSep,
+		TokenComparison:      p.handleComparison,
+		TokenVariable:        p.handleVariable,
+		TokenIdentifier:      p.handleIdentifier,
+		TokenError:           p.handleErr,
 	}
 	return p
 }
@@ -54,109 +118,352 @@ func (p *parser) push(n *node) {
 	p.stack = append(p.stack, n)
 }
 
+func (p *parser) popOperator() *node {
+	n := p.operators[len(p.operators)-1]
+	p.operators = p.operators[:len(p.operators)-1]
+	return n
+}
+
+func (p *parser) peekOperator() *node {
+	if len(p.operators) == 0 {
+		return nil
+	}
+	return p.operators[len(p.operators)-1]
+}
+
+//Parse parses a single expression.
 func (p *parser) Parse() (AST, error) {
+	asts, err := p.ParseAll()
+	if err != nil || len(asts) == 0 {
+		return (*node)(nil), err
+	}
+	if len(asts) > 1 {
+		return (*node)(nil), at(parseError(ErrorSyntax, "parse error: expected 1 expression, got %d", len(asts)),
+			p.separator.Offset, p.separator.Value)
+	}
+	return asts[0], nil
+}
+
+//ParseAll parses a `,` delimited list of independent expressions.
+//Within parentheses a `,` delimited list forms a single group, as in `1b(d6,d8)`.
+func (p *parser) ParseAll() ([]AST, error) {
 	p.l.Lex(p.accumulator)
-	for i, n := range p.stack {
-		if i > 0 && p != nil && p.stack[i-1] != nil {
-			p.stack[i-1].operand2 = n
-		}
+	if p.in.err != nil {
+		return nil, p.in.err
+	}
+	if p.err != nil {
+		return nil, p.err
 	}
-	var n *node
-	if len(p.stack) > 0 {
-		n = p.stack[0]
+	asts := make([]AST, len(p.exprs))
+	for i, n := range p.exprs {
+		if err := p.limits.checkDepth(n); err != nil {
+			return nil, err
+		}
+		asts[i] = n
 	}
-	return n, p.err
+	return asts, nil
 }
 
 func (p *parser) accumulator(t Token) {
+	if p.err == nil && p.identifier != "" && t.Kind != TokenOpenParen {
+		//an identifier not followed by `(` names a macro or parameter
+		p.err = at(p.expand(p.identifier, nil), p.identifierOffset, p.identifier)
+		p.identifier = ""
+	}
 	if p.err == nil {
 		fn, ok := p.registry[t.Kind]
 		if ok {
-			ast, err := fn(p.pop(), t)
-			p.err = err
-			p.push(ast)
+			p.err = locate(fn(t), t)
 		} else {
 			p.err = fmt.Errorf("unregistered Token Type: %v", t)
 		}
 	}
 }
 
-type tokenProcessor func(ast *node, t Token) (*node, error)
+type tokenProcessor func(t Token) error
 
-func handleLiteral(prev *node, t Token) (*node, error) {
-	i, err := strconv.ParseInt(t.Value, 10, 64)
+func (p *parser) handleLiteral(t Token) error {
+	whole, fraction, _ := strings.Cut(t.Value, ".")
+	if strings.Trim(fraction, "0123456789") != "" {
+		return parseError(ErrorNumber, "parse error: malformed number %s", t.Value)
+	}
+	i, err := strconv.ParseInt(whole, 10, 64)
+	if errors.Is(err, strconv.ErrRange) || int64(int(i)) != i {
+		return parseError(ErrorNumber, "parse error: %w in %s", ErrOverflow, t.Value)
+	}
 	n := &node{
 		kind: NodeTypeLeaf,
 		v:    int(i),
 	}
+	if !p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: %v %v", p.pop(), n)
+	}
+	p.push(n)
+	p.expectOperand = false
+	return err
+}
 
-	if prev == nil {
-		return n, err
+func (p *parser) handleVariable(t Token) error {
+	n := &node{kind: NodeTypeVariable, name: t.Value}
+	if !p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: %v %v", p.pop(), n)
 	}
-	switch prev.kind {
-	case NodeTypeLeaf:
-		return nil, fmt.Errorf("parse error: %v %v", prev, n)
-	case NodeTypeInfixOperator:
-		if prev.operand2 == nil {
-			prev.operand2 = n
-			return prev, nil
+	p.push(n)
+	p.expectOperand = false
+	return nil
+}
+
+//handleIdentifier holds the identifier until the next token shows whether it is a call, as in `adv(3)`.
+func (p *parser) handleIdentifier(t Token) error {
+	if !p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: %v %s", p.pop(), t.Value)
+	}
+	p.identifier = t.Value
+	p.identifierOffset = t.Offset
+	return nil
+}
+
+//expand pushes the body of the macro name, with its parameters replaced by args.
+//The args of a reference without parentheses are nil. Within a macro body the macro's parameters expand to
+//placeholders for their arguments.
+func (p *parser) expand(name string, args []*node) error {
+	for _, param := range p.params {
+		if param == name && args == nil {
+			p.push(&node{kind: NodeTypeLeaf, param: name})
+			p.expectOperand = false
+			return nil
+		}
+	}
+	f, err := call(name, args)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		p.push(f)
+		p.expectOperand = false
+		return nil
+	}
+	m, ok := p.macros[name]
+	if !ok {
+		return parseError(ErrorName, "parse error: unknown macro %s", name)
+	}
+	if len(args) != len(m.Params) {
+		return parseError(ErrorArguments, "parse error: %s takes %d arguments, got %d", name, len(m.Params), len(args))
+	}
+	bound := map[string]*node{}
+	for i, param := range m.Params {
+		bound[param] = args[i]
+	}
+	//a macro reads as one value, so `fireball = 24` checks its total like `(8d6) = 24`
+	body := m.Body.(*node).expand(bound)
+	p.parenthesised[body] = true
+	p.push(body)
+	p.expectOperand = false
+	return nil
+}
+
+func (p *parser) handlePre(t Token) error {
+	if !p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: unexpected prefix operator %s", t.Value)
+	}
+	p.operators = append(p.operators, &node{kind: NodeTypePrefixOperator, operator: t.Value, offset: t.Offset})
+	return nil
+}
+
+func (p *parser) handlePos(t Token) error {
+	n := &node{kind: NodeTypePostfixOperator, operator: t.Value}
+	cp := operatorPrecedence[t.Value]
+	faces, err := p.faces(t.Value)
+	if err != nil {
+		return err
+	}
+	if faces != nil {
+		n.faces = faces
+		n.symbols = narrativeDice[t.Value[1:]]
+		cp = operatorPrecedence["d"]
+	}
+	p.implicitOperand()
+	if err := p.reduceWhile(cp); err != nil {
+		return err
+	}
+	n.operand1 = p.pop()
+	p.push(n)
+	return nil
+}
+
+//faces are the faces of the dice rolled by a postfix dice operator such as `d%`, `d{1,1,2}` or `dAvg`,
+//nil for other operators.
+func (p *parser) faces(operator string) ([]int, error) {
+	switch {
+	case operator == "d%":
+		return dieFaces(100), nil
+	case strings.HasPrefix(operator, "d{"):
+		return parseFaces(operator)
+	case len(operator) > 1 && operator[0] == 'd' && isCapital(operator[1]):
+		faces, ok := p.dice.faces(operator[1:])
+		if !ok {
+			return nil, parseError(ErrorName, "parse error: unknown die %s", operator)
 		}
-		return nil, fmt.Errorf("parse error: %v %v", prev, n)
-	default:
-		return nil, fmt.Errorf("parse error: %v %v", prev, n)
+		return faces, nil
 	}
+	return nil, nil
 }
-func (p *parser) handlePre(ast *node, t Token) (i *node, e error) {
-	return p.operator(NodeTypePrefixOperator, ast, t), nil
+
+//handleErr reports the error which ended lexing.
+func (p *parser) handleErr(t Token) error {
+	if p.l.err != nil {
+		return p.l.err
+	}
+	return errors.New(t.Value)
 }
-func (p *parser) handlePos(ast *node, t Token) (i *node, e error) {
-	return p.operator(NodeTypePostfixOperator, ast, t), nil
+
+//handleIFO handles infix operators. A comparator marked by `#`, as in `8d10#>=7`, counts successes.
+func (p *parser) handleIFO(t Token) error {
+	return p.infix(&node{kind: NodeTypeInfixOperator, operator: strings.TrimPrefix(t.Value, "#"), offset: t.Offset})
 }
 
-func handleErr(ast *node, t Token) (i *node, e error) {
-	return nil, errors.New(t.Value)
+//handleComparison checks the total on its left against the total on its right.
+func (p *parser) handleComparison(t Token) error {
+	return p.infix(&node{kind: NodeTypeInfixOperator, operator: t.Value, check: true, offset: t.Offset})
 }
 
-func (p *parser) handleIFO(ast *node, t Token) (i *node, e error) {
-	return p.operator(NodeTypeInfixOperator, ast, t), nil
+//infix pushes the infix operator o. Only the wordOperators may miss their left operand, any other operator missing it,
+//as the `*` of `3d6+*2`, is an error.
+func (p *parser) infix(o *node) error {
+	if _, ok := wordOperators[o.operator]; p.expectOperand && !ok {
+		return parseError(ErrorSyntax, "parse error: missing left operand of %s", o.operator)
+	}
+	p.implicitOperand()
+	if err := p.reduceWhile(precedence(o)); err != nil {
+		return err
+	}
+	p.operators = append(p.operators, o)
+	p.expectOperand = true
+	return nil
 }
 
-func (p *parser) operator(kind NodeType, ast *node, t Token) *node {
-	o1 := ast
-	if o1 == nil {
-		o1 = &node{kind: NodeTypeLeaf, v: 1}
+//implicitOperand supplies the literal 1 to an operator missing its left operand, so `d6` reads as `1d6`.
+func (p *parser) implicitOperand() {
+	if p.expectOperand {
+		p.push(&node{kind: NodeTypeLeaf, v: 1})
+		p.expectOperand = false
 	}
-	if o1.kind == NodeTypeInfixOperator || o1.kind == NodeTypePrefixOperator || o1.kind == NodeTypePostfixOperator {
-		pp := operatorPrecedence[o1.operator]
-		cp := operatorPrecedence[t.Value]
-		if cp > pp {
-			n := &node{
-				kind:     kind,
-				operator: t.Value,
-				operand1: o1.operand2,
-			}
-			o1.operand2 = n
-			p.push(o1)
-			return n
+}
+
+//reduceWhile applies pending operators which bind at least as tightly as the precedence cp.
+func (p *parser) reduceWhile(cp byte) error {
+	for o := p.peekOperator(); o != nil && !o.isOpenParen() && precedence(o) >= cp; o = p.peekOperator() {
+		if err := p.reduce(); err != nil {
+			return err
 		}
 	}
-	n := &node{
-		kind:     kind,
-		operator: t.Value,
-		operand1: o1,
+	return nil
+}
+
+//reduceAll applies every pending operator back to the nearest open paren.
+func (p *parser) reduceAll() error {
+	for o := p.peekOperator(); o != nil && !o.isOpenParen(); o = p.peekOperator() {
+		if err := p.reduce(); err != nil {
+			return err
+		}
 	}
-	return n
+	return nil
 }
 
-func handleEOS(ast *node, t Token) (i *node, e error) {
-	return ast, nil
+func (p *parser) reduce() error {
+	o := p.popOperator()
+	switch o.kind {
+	case NodeTypeInfixOperator:
+		o.operand2 = p.pop()
+		o.operand1 = p.pop()
+	case NodeTypePrefixOperator:
+		o.operand1 = p.pop()
+	}
+	if o.operand1 == nil {
+		return at(parseError(ErrorSyntax, "parse error: missing operand for %s", o.operator), o.offset, o.operator)
+	}
+	if o.check && (o.operand1.isCheck() || o.operand2.isCheck()) {
+		return at(parseError(ErrorSyntax, "parse error: chained comparison %v %s %v, combine checks with && or ||",
+			o.operand1, o.operator, o.operand2), o.offset, o.operator)
+	}
+	if o.check && o.operand1.isPool() && !p.parenthesised[o.operand1] {
+		return at(parseError(ErrorSyntax, "parse error: ambiguous %s on the dice pool %v, count successes with #%s "+
+			"or check the total of the pool in parentheses", o.operator, o.operand1, o.operator), o.offset, o.operator)
+	}
+	p.push(o)
+	return nil
 }
 
-func (p *parser) handleOP(ast *node, t Token) (i *node, e error) {
-	p.push(ast)
-	return nil, nil
+func (p *parser) handleEOS(t Token) error {
+	if p.expectOperand && (len(p.operators) > 0 || len(p.exprs) > 0) {
+		return parseError(ErrorSyntax, "parse error: unexpected end of expression")
+	}
+	if err := p.reduceAll(); err != nil {
+		return err
+	}
+	if o := p.peekOperator(); o != nil {
+		return at(parseError(ErrorSyntax, "parse error: unbalanced ("), o.offset, o.name+"(")
+	}
+	if n := p.pop(); n != nil {
+		p.exprs = append(p.exprs, n)
+	}
+	return nil
+}
+
+func (p *parser) handleOP(t Token) error {
+	if !p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: unexpected ( after %v", p.pop())
+	}
+	group := &node{kind: NodeTypeGroup, operator: "(", name: p.identifier, offset: t.Offset}
+	if p.identifier != "" {
+		group.offset = p.identifierOffset
+	}
+	p.operators = append(p.operators, group)
+	p.identifier = ""
+	return nil
 }
 
-func (p *parser) handleCP(ast *node, t Token) (i *node, e error) {
-	return ast, nil
+func (p *parser) handleCP(t Token) error {
+	if o := p.peekOperator(); p.expectOperand && o != nil && o.isCall() && len(o.operands) == 0 {
+		p.popOperator()
+		return at(p.expand(o.name, []*node{}), o.offset, o.name)
+	}
+	if p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: unexpected )")
+	}
+	if err := p.reduceAll(); err != nil {
+		return err
+	}
+	if len(p.operators) == 0 {
+		return parseError(ErrorSyntax, "parse error: unbalanced )")
+	}
+	if group := p.popOperator(); group.isCall() {
+		return at(p.expand(group.name, append(group.operands, p.pop())), group.offset, group.name)
+	} else if len(group.operands) > 0 {
+		group.operands = append(group.operands, p.pop())
+		group.operator = ""
+		p.push(group)
+	} else {
+		p.parenthesised[p.stack[len(p.stack)-1]] = true
+	}
+	return nil
+}
+
+func (p *parser) handleSep(t Token) error {
+	if p.expectOperand {
+		return parseError(ErrorSyntax, "parse error: unexpected %s", t.Value)
+	}
+	if err := p.reduceAll(); err != nil {
+		return err
+	}
+	if group := p.peekOperator(); group != nil {
+		group.operands = append(group.operands, p.pop())
+	} else {
+		p.exprs = append(p.exprs, p.pop())
+		if p.separator == nil {
+			p.separator = &t
+		}
+	}
+	p.expectOperand = true
+	return nil
 }
@@ -0,0 +1,101 @@
+package lex
+
+//Die is a single die rolled while evaluating an AST.
+type Die struct {
+	//Sides of the die. Fudge dice have 3 sides valued -1, 0 and 1, custom dice a side for each of their faces.
+	Sides int
+	//Value rolled.
+	Value int
+	//Dropped dice were rolled but not selected by a best, worst, keep or drop operator.
+	Dropped bool
+	//Exploded dice matched the explosion condition, by default their highest face, the next die was rolled as a bonus.
+	//A compounded die's Value is the total of the die and its bonus dice.
+	Exploded bool
+	//Wild dice are Savage Worlds wild dice.
+	Wild bool
+	//Rerolled dice matched a reroll condition, the next die was rolled in their place.
+	Rerolled bool
+	//Success dice matched the target number of a success count.
+	Success bool
+	//Failure dice matched the failure condition of a success count.
+	Failure bool
+	//Symbols on the face of a narrative die.
+	Symbols Symbols
+}
+
+//RollResult is the outcome of evaluating a node of an AST. It mirrors the shape of the AST.
+type RollResult struct {
+	Kind     NodeType
+	Operator string
+	//Variable is the name of a variable node, without its `@`.
+	Variable string
+	//Total is the subtotal of this node.
+	Total int
+	//Dice rolled or selected by this node.
+	Dice []Die
+	//Operands are the results of the node's operands, in order.
+	Operands []*RollResult
+	//Dropped group members were not selected by a best, worst, keep or drop operator.
+	Dropped bool
+	//SnakeEyes is a Savage Worlds critical failure, the trait and wild die both came up 1.
+	SnakeEyes bool
+	//Raises are the Savage Worlds raises over the target number of 4.
+	Raises int
+	//Check is true of comparisons, such as `d20+5 >= 15`, and of their `&&` and `||` combinations.
+	Check bool
+	//Passed checks total 1, failed checks 0.
+	Passed bool
+	//Margin of a check is how far its total was past the closest passing total, negative when the check failed.
+	Margin int
+	//Symbols of the narrative dice rolled by this node, once failures and threats have cancelled successes and
+	//advantages. Nil when the node rolled no narrative dice.
+	Symbols *Symbols
+}
+
+//Result describes the evaluation of the node and the nodes beneath it.
+func (n *rolled) Result() *RollResult {
+	if n == nil {
+		return nil
+	}
+	r := &RollResult{
+		Kind:     n.kind,
+		Operator: n.operator,
+		Variable: n.name,
+		Total:    n.v,
+		Dice:     n.dice,
+	}
+	if s, ok := n.tally(); ok {
+		cancelled := s.Cancel()
+		r.Symbols = &cancelled
+	}
+	for _, o := range []*rolled{n.operand1, n.operand2} {
+		if o != nil {
+			r.Operands = append(r.Operands, o.Result())
+		}
+	}
+	for _, o := range n.operands {
+		r.Operands = append(r.Operands, o.Result())
+	}
+	if n.isSelection() && n.selectionSource().kind == NodeTypeGroup {
+		group := r.Operands[0]
+		if n.selectionSource() == n.operand2 {
+			group = r.Operands[1]
+		}
+		for _, member := range group.Operands {
+			member.Dropped = true
+		}
+		for _, p := range n.picks {
+			group.Operands[p].Dropped = false
+		}
+	}
+	if n.isCheck() {
+		r.Check = true
+		r.Passed = n.v == 1
+		r.Margin = n.margin
+	}
+	if n.wild != nil {
+		r.SnakeEyes = n.wild.snakeEyes
+		r.Raises = n.wild.raises
+	}
+	return r
+}
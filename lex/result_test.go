@@ -0,0 +1,153 @@
+package lex
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func rollResult(test string, t *testing.T) *RollResult {
+	ast, err := NewParser(strings.NewReader(test)).Parse()
+	if err != nil {
+		t.Fatal("ERROR", test, err)
+	}
+	e, err := ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+	if err != nil {
+		t.Fatal("ERROR", test, err)
+	}
+	return e.Result()
+}
+
+func Test_result_arithmetic(t *testing.T) {
+	r := rollResult("1+2*3", t)
+	if r.Total != 7 || r.Operator != "+" || len(r.Operands) != 2 {
+		t.Errorf("ERROR 1+2*3 got %+v", r)
+	}
+	if r.Operands[0].Kind != NodeTypeLeaf || r.Operands[0].Total != 1 || r.Operands[1].Total != 6 {
+		t.Errorf("ERROR 1+2*3 operands %+v %+v", r.Operands[0], r.Operands[1])
+	}
+}
+
+func Test_result_dice(t *testing.T) {
+	r := rollResult("3b4d6", t)
+	dice := r.Operands[1].Dice
+	if len(dice) != 4 || len(r.Dice) != 4 {
+		t.Fatalf("ERROR 3b4d6 expected 4 dice got %v and %v", dice, r.Dice)
+	}
+	kept, dropped := 0, 0
+	for i, d := range r.Dice {
+		if d.Value != dice[i].Value || d.Sides != 6 || dice[i].Dropped {
+			t.Errorf("ERROR 3b4d6 die %d: %+v rolled as %+v", i, d, dice[i])
+		}
+		if d.Dropped {
+			dropped++
+		} else {
+			kept += d.Value
+		}
+	}
+	if dropped != 1 || kept != r.Total || r.Total != 17 {
+		t.Errorf("ERROR 3b4d6 kept %d dropped %d dice of %v total %d", kept, dropped, r.Dice, r.Total)
+	}
+}
+
+func Test_result_exploded(t *testing.T) {
+	r := rollResult("2d6!", t)
+	expected := []Die{{Sides: 6, Value: 1}, {Sides: 6, Value: 6, Exploded: true}, {Sides: 6, Value: 6, Exploded: true}, {Sides: 6, Value: 5}}
+	if len(r.Dice) != len(expected) {
+		t.Fatalf("ERROR 2d6! expected %v got %v", expected, r.Dice)
+	}
+	for i, d := range expected {
+		if r.Dice[i] != d {
+			t.Errorf("ERROR 2d6! expected %v got %v", expected, r.Dice)
+		}
+	}
+}
+
+func Test_result_compounded(t *testing.T) {
+	r := rollResult("2d6!!", t)
+	expected := []Die{{Sides: 6, Value: 1}, {Sides: 6, Value: 17, Exploded: true}}
+	if len(r.Dice) != len(expected) {
+		t.Fatalf("ERROR 2d6!! expected %v got %v", expected, r.Dice)
+	}
+	for i, d := range expected {
+		if r.Dice[i] != d {
+			t.Errorf("ERROR 2d6!! expected %v got %v", expected, r.Dice)
+		}
+	}
+}
+
+func Test_result_group(t *testing.T) {
+	r := rollResult("1b(3,5)", t)
+	group := r.Operands[1]
+	if r.Total != 5 || group.Kind != NodeTypeGroup || len(group.Operands) != 2 {
+		t.Fatalf("ERROR 1b(3,5) got %+v", r)
+	}
+	if !group.Operands[0].Dropped || group.Operands[1].Dropped {
+		t.Errorf("ERROR 1b(3,5) expected 3 dropped got %+v %+v", group.Operands[0], group.Operands[1])
+	}
+}
+
+func Test_result_wild(t *testing.T) {
+	r := rollResult("d8w", t)
+	wild := 0
+	for _, d := range r.Dice {
+		if d.Wild {
+			wild++
+		}
+	}
+	if wild == 0 || len(r.Dice) < 2 || r.Raises != (r.Total-4)/4 && r.Total >= 4 {
+		t.Errorf("ERROR d8w got %+v", r)
+	}
+}
+
+func Test_result_keep(t *testing.T) {
+	r := rollResult("4d6kl1", t)
+	dropped := 0
+	for _, d := range r.Dice {
+		if d.Dropped {
+			dropped++
+		} else if d.Value != r.Total {
+			t.Errorf("ERROR 4d6kl1 kept %v total %d", d, r.Total)
+		}
+	}
+	if len(r.Dice) != 4 || dropped != 3 {
+		t.Errorf("ERROR 4d6kl1 expected 3 of 4 dice dropped got %v", r.Dice)
+	}
+}
+
+func Test_result_reroll(t *testing.T) {
+	r := rollResult("10d6r<3", t)
+	rerolled, total := 0, 0
+	for _, d := range r.Dice {
+		if d.Rerolled {
+			rerolled++
+			if d.Value >= 3 {
+				t.Errorf("ERROR 10d6r<3 rerolled %v", d)
+			}
+		} else {
+			total += d.Value
+		}
+	}
+	if len(r.Dice)-rerolled != 10 || total != r.Total {
+		t.Errorf("ERROR 10d6r<3 expected 10 dice totalling %d got %v", r.Total, r.Dice)
+	}
+}
+
+func Test_result_successes(t *testing.T) {
+	r := rollResult("8d10#>=7f1", t)
+	total := 0
+	for _, d := range r.Dice {
+		if d.Success != (d.Value >= 7) || d.Failure != (d.Value == 1) {
+			t.Errorf("ERROR 8d10#>=7f1 marked %+v", d)
+		}
+		if d.Success {
+			total++
+		}
+		if d.Failure {
+			total--
+		}
+	}
+	if len(r.Dice) != 8 || total != r.Total {
+		t.Errorf("ERROR 8d10#>=7f1 expected 8 dice scoring %d got %v", r.Total, r.Dice)
+	}
+}
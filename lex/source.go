@@ -0,0 +1,7 @@
+package lex
+
+//Source supplies the random numbers dice are rolled with. A *rand.Rand is a Source.
+type Source interface {
+	//Intn returns a number in [0,n).
+	Intn(n int) int
+}
@@ -8,27 +8,71 @@ import (
 type stateFn func(l *lexer) stateFn
 
 func detector(l *lexer) stateFn {
+	l.start = l.pos
+	if isLetter(l.byte()) && !l.operandEnded() {
+		l.token = nil
+		return readingWord
+	}
 	switch l.byte() {
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 		l.token = nil
 		return readingNumber
+	case ' ', '\t', '\r', '\n':
+		l.token = nil
+		return advanceOneByte
 	case '(':
-		l.token = &Token{Kind: TokenOpenParen, Value: string(l.buf)}
+		l.emit(TokenOpenParen, string(l.buf))
 		return advanceOneByte
 	case ')':
-		l.token = &Token{Kind: TokenCloseParen, Value: string(l.buf)}
+		l.emit(TokenCloseParen, string(l.buf))
 		return advanceOneByte
-	case '+', '-', '*', '/', 'b', 'w':
-		l.token = &Token{Kind: TokenInfixOperator, Value: string(l.buf)}
+	case ',':
+		l.emit(TokenSeparator, string(l.buf))
 		return advanceOneByte
-	case '!':
-		l.token = &Token{Kind: TokenPostfixOperator, Value: string(l.buf)}
+	case '-':
+		//without a left operand `-` negates, as in `-2+d6` or `d6*-1`
+		tt := TokenPrefixOperator
+		if l.operandEnded() {
+			tt = TokenInfixOperator
+		}
+		l.emit(tt, string(l.buf))
 		return advanceOneByte
+	case '+', '*', '/', 'b', 'f':
+		l.emit(TokenInfixOperator, string(l.buf))
+		return advanceOneByte
+	case 'w':
+		l.token = nil
+		return readingWorstOrWild
+	case '!':
+		l.token = nil
+		return readingExplode
 	case 'd':
 		l.token = nil
 		return readingDiceRoller
+	case 'k':
+		l.token = nil
+		return readingKeep
+	case 'r':
+		l.token = nil
+		return readingReroll
+	case '<', '>', '=':
+		l.token = nil
+		return readingComparator
+	case '#':
+		l.token = nil
+		return readingCount
+	case '&', '|':
+		l.token = nil
+		return readingLogic
+	case '@':
+		l.token = nil
+		return readingVariable
 	default:
-		return l.handleError(fmt.Errorf("unhandled char: %c @ offset %d", l.byte(), l.pos))
+		if isLetter(l.byte()) {
+			l.token = nil
+			return readingWord
+		}
+		return l.handleError(unhandledChar(l.byte(), l.pos))
 	}
 }
 
@@ -48,11 +92,11 @@ func readingNumber(l *lexer) stateFn {
 	bytes := make([]byte, 0)
 	var err error
 
-	for l.byte() >= '0' && l.byte() <= '9' && err == nil {
+	for (isDigit(l.byte()) || l.byte() == '.') && err == nil {
 		bytes = append(bytes, l.byte())
 		_, err = l.read()
 	}
-	l.token = &Token{Kind: TokenLiteral, Value: string(bytes)}
+	l.emit(TokenLiteral, string(bytes))
 	if err != nil {
 		return l.handleReadError(err)
 	}
@@ -65,28 +109,300 @@ func (l *lexer) read() (int, error) {
 	return n, err
 }
 
+//readingDiceRoller reads `d` as the infix dice operator, `d%`, custom dice such as `d{1,1,2}` and named dice
+//such as `dF` as postfix dice operators and `dh` and `dl` as drop modifiers.
 func readingDiceRoller(l *lexer) stateFn {
+	bytes := []byte{l.byte()}
+	tt := TokenInfixOperator
+	_, err := l.read()
+	if err == nil {
+		switch {
+		case l.byte() == '%':
+			bytes = append(bytes, l.byte())
+			tt = TokenPostfixOperator
+			_, err = l.read()
+		case l.byte() == '{':
+			return readingFaces
+		case isCapital(l.byte()):
+			return readingNamedDie
+		case l.byte() == 'h' || l.byte() == 'l':
+			bytes = append(bytes, l.byte())
+			return l.modifier(string(bytes), isDigit)
+		}
+	}
+	l.emit(tt, string(bytes))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+//readingKeep reads the `kh` and `kl` keep modifiers.
+func readingKeep(l *lexer) stateFn {
+	if _, err := l.read(); err != nil {
+		return l.handleError(unhandledChar('k', l.pos))
+	}
+	switch l.byte() {
+	case 'h', 'l':
+		return l.modifier("k"+string(l.buf), isDigit)
+	default:
+		return l.handleError(unhandledChar(l.byte(), l.pos))
+	}
+}
+
+//readingReroll reads the `r` reroll and `ro` reroll once modifiers.
+func readingReroll(l *lexer) stateFn {
+	bytes := []byte{l.byte()}
+	_, err := l.read()
+	if err == nil && l.byte() == 'o' {
+		bytes = append(bytes, l.byte())
+		_, err = l.read()
+	}
+	l.emit(TokenInfixOperator, string(bytes))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+//readingComparator reads `<`, `<=`, `>`, `>=` and `=`. Following an operand a comparator is a comparison, such as
+//`d20+5 >= 15`, otherwise it is a prefix condition such as the `<3` of `2d6ro<3`.
+func readingComparator(l *lexer) stateFn {
+	bytes, err := l.comparator(nil)
+	tt := TokenPrefixOperator
+	if l.operandEnded() {
+		tt = TokenComparison
+	}
+	l.emit(tt, string(bytes))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+//readingCount reads `#` and the comparator following it, such as the `#>=` of `8d10#>=7`, as an infix operator
+//counting the dice which match the comparator.
+func readingCount(l *lexer) stateFn {
+	if !l.operandEnded() {
+		return l.handleError(unhandledChar('#', l.pos))
+	}
+	if _, err := l.read(); err != nil {
+		return l.handleError(unhandledChar('#', l.start))
+	}
+	if !isComparator(l.byte()) {
+		return l.handleError(unhandledChar(l.byte(), l.pos))
+	}
+	bytes, err := l.comparator([]byte{'#'})
+	l.emit(TokenInfixOperator, string(bytes))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+//comparator appends the comparator starting at the current byte to bytes, reading `<=` and `>=` as one comparator.
+func (l *lexer) comparator(bytes []byte) ([]byte, error) {
+	first := l.byte()
+	bytes = append(bytes, first)
+	_, err := l.read()
+	if err == nil && first != '=' && l.byte() == '=' {
+		bytes = append(bytes, l.byte())
+		_, err = l.read()
+	}
+	return bytes, err
+}
+
+//readingExplode reads the `!` exploding, `!!` compounding and `!p` penetrating modifiers.
+//Followed by a threshold, as in `d10!>=9`, the modifier is an infix operator, otherwise it is a postfix operator.
+func readingExplode(l *lexer) stateFn {
+	bytes := []byte{l.byte()}
+	_, err := l.read()
+	if err == nil && (l.byte() == '!' || l.byte() == 'p') {
+		bytes = append(bytes, l.byte())
+		_, err = l.read()
+	}
+	tt := TokenPostfixOperator
+	if err == nil && (isDigit(l.byte()) || isComparator(l.byte())) {
+		tt = TokenInfixOperator
+	}
+	l.emit(tt, string(bytes))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+//wordOperators are the operators which may start an operand, such as the `d` of `d6` or the `b` of `b(d6,d8)`.
+var wordOperators = map[string]TokenType{
+	"d": TokenInfixOperator,
+	"b": TokenInfixOperator,
+	"w": TokenInfixOperator,
+}
+
+//readingWord reads the letters starting an operand. They are one of the wordOperators or a custom or named die,
+//otherwise they start an identifier naming a macro or function, such as `fireball` or `adv(3)`.
+func readingWord(l *lexer) stateFn {
 	bytes := make([]byte, 0)
 	var err error
+	for err == nil && isLetter(l.byte()) {
+		if string(bytes) == "d" && isCapital(l.byte()) {
+			return readingNamedDie
+		}
+		bytes = append(bytes, l.byte())
+		_, err = l.read()
+	}
+	tt, ok := wordOperators[string(bytes)]
+	switch {
+	case string(bytes) == "d" && err == nil && l.byte() == '{':
+		return readingFaces
+	case string(bytes) == "d" && err == nil && l.byte() == '%':
+		bytes = append(bytes, l.byte())
+		tt = TokenPostfixOperator
+		_, err = l.read()
+	case !ok:
+		for err == nil && isIdentifier(l.byte()) {
+			bytes = append(bytes, l.byte())
+			_, err = l.read()
+		}
+		tt = TokenIdentifier
+	}
+	l.emit(tt, string(bytes))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
 
-	acceptable := func(b byte) bool {
-		return b == 'd' || b == 'F' || b == '%'
+//readingNamedDie reads the name of a die following its `d`, such as the `Avg` of `2dAvg`, as a postfix dice
+//operator. The name read is the longest of the dice names, so `4dFkh3` keeps the highest 3 of 4 fudge dice.
+//A name which isn't a die's is read whole, as the `dAvg` of `2dAvg+1`, for the parser to report the unknown die.
+func readingNamedDie(l *lexer) stateFn {
+	name := make([]byte, 0)
+	var err error
+	for err == nil && l.dice.isPrefix(string(name)+string(l.byte())) {
+		name = append(name, l.byte())
+		_, err = l.read()
+	}
+	if _, ok := l.dice.faces(string(name)); !ok {
+		for err == nil && isIdentifier(l.byte()) {
+			name = append(name, l.byte())
+			_, err = l.read()
+		}
+	}
+	l.emit(TokenPostfixOperator, "d"+string(name))
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+//readingFaces reads the faces of a custom die, such as `d{1,1,2,2,3,4}`, as a postfix dice operator.
+func readingFaces(l *lexer) stateFn {
+	bytes := []byte("d{")
+	_, err := l.read()
+	for err == nil && l.byte() != '}' {
+		switch {
+		case isDigit(l.byte()) || l.byte() == '-' || l.byte() == ',':
+			bytes = append(bytes, l.byte())
+		case !isSpace(l.byte()):
+			return l.handleError(unhandledChar(l.byte(), l.pos))
+		}
+		_, err = l.read()
+	}
+	if err == io.EOF {
+		return l.handleError(&ParseError{
+			Category: ErrorSyntax,
+			Offset:   l.start,
+			Token:    string(bytes),
+			Err:      fmt.Errorf("unterminated faces: %s", bytes),
+		})
+	}
+	if err != nil {
+		return l.handleError(err)
 	}
-	for acceptable(l.byte()) && err == nil {
+	l.emit(TokenPostfixOperator, string(bytes)+"}")
+	return advanceOneByte
+}
+
+//readingVariable reads the name of a variable such as `@str_mod`, made of letters, digits and underscores.
+func readingVariable(l *lexer) stateFn {
+	at := l.pos
+	bytes := make([]byte, 0)
+	_, err := l.read()
+	for err == nil && isIdentifier(l.byte()) {
 		bytes = append(bytes, l.byte())
 		_, err = l.read()
 	}
-	tt := TokenInfixOperator
-	if len(bytes) > 1 {
-		tt = TokenPostfixOperator
+	if len(bytes) == 0 {
+		return l.handleError(unhandledChar('@', at))
 	}
-	l.token = &Token{Kind: tt, Value: string(bytes)}
+	l.emit(TokenVariable, string(bytes))
 	if err != nil {
 		return l.handleReadError(err)
 	}
 	return detector
 }
 
+//readingLogic reads the `&&` and `||` operators combining checks.
+func readingLogic(l *lexer) stateFn {
+	first := l.byte()
+	if _, err := l.read(); err != nil || l.byte() != first {
+		return l.handleError(at(parseError(ErrorSyntax, "parse error: expected %c%c", first, first), l.start, string(first)))
+	}
+	l.token = &Token{Kind: TokenInfixOperator, Value: string([]byte{first, first})}
+	return advanceOneByte
+}
+
+//readingWorstOrWild reads `w` as the infix worst operator when an operand follows (`2w4d6`),
+//otherwise as the postfix Savage Worlds wild die operator (`d8w`).
+func readingWorstOrWild(l *lexer) stateFn {
+	return l.modifier(string(l.buf), func(b byte) bool {
+		return isDigit(b) || b == '(' || b == 'd'
+	})
+}
+
+//modifier emits value as an infix operator when the next byte starts its operand, otherwise as a postfix operator.
+//Whitespace may come between the modifier and its operand.
+func (l *lexer) modifier(value string, operand func(b byte) bool) stateFn {
+	_, err := l.read()
+	for err == nil && isSpace(l.byte()) {
+		_, err = l.read()
+	}
+	tt := TokenPostfixOperator
+	if err == nil && operand(l.byte()) {
+		tt = TokenInfixOperator
+	}
+	l.emit(tt, value)
+	if err != nil {
+		return l.handleReadError(err)
+	}
+	return detector
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isLetter(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func isCapital(b byte) bool {
+	return b >= 'A' && b <= 'Z'
+}
+
+func isIdentifier(b byte) bool {
+	return isDigit(b) || isLetter(b)
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func isComparator(b byte) bool {
+	return b == '<' || b == '>' || b == '='
+}
+
 func (l *lexer) handleReadError(err error) stateFn {
 	if err == io.EOF {
 		return endOfStream
@@ -95,15 +411,25 @@ func (l *lexer) handleReadError(err error) stateFn {
 }
 
 func endOfStream(l *lexer) stateFn {
-	l.token = &Token{Kind: TokenEndOfStream}
+	l.token = &Token{Kind: TokenEndOfStream, Offset: l.pos + 1}
 	return terminal
 }
 
+//handleError ends lexing with an error token, keeping the error for the parser to report.
 func (l *lexer) handleError(err error) stateFn {
-	l.token = &Token{Kind: TokenError, Value: err.Error()}
+	l.err = err
+	l.token = &Token{Kind: TokenError, Value: err.Error(), Offset: l.pos}
+	if pe, ok := err.(*ParseError); ok {
+		l.token.Offset = pe.Offset
+	}
 	return terminal
 }
 
+//emit emits a token of the kind with the value, starting at the byte the detector last read.
+func (l *lexer) emit(kind TokenType, value string) {
+	l.token = &Token{Kind: kind, Value: value, Offset: l.start}
+}
+
 func terminal(l *lexer) stateFn {
 	l.token = nil
 	return nil
@@ -0,0 +1,99 @@
+package lex
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+//percentileTolerance absorbs the rounding error accumulated while computing a distribution.
+const percentileTolerance = 1e-9
+
+//SummaryPercentiles are the percentiles reported by Statistics.
+var SummaryPercentiles = []int{5, 10, 25, 75, 90, 95}
+
+//Statistics summarises a Distribution.
+type Statistics struct {
+	Mean     float64
+	Variance float64
+	StdDev   float64
+	Min      int
+	Max      int
+	Median   int
+	//Percentiles maps each of SummaryPercentiles to the lowest total at or above that percentile.
+	Percentiles map[int]int
+}
+
+func (s Statistics) String() string {
+	p := make([]string, len(SummaryPercentiles))
+	for i, pc := range SummaryPercentiles {
+		p[i] = fmt.Sprintf("p%d %d", pc, s.Percentiles[pc])
+	}
+	return fmt.Sprintf("mean %.2f sd %.2f range [%d,%d] median %d %s",
+		s.Mean, s.StdDev, s.Min, s.Max, s.Median, strings.Join(p, " "))
+}
+
+//Statistics summarises the distribution.
+func (d Distribution) Statistics() Statistics {
+	outcomes := d.Outcomes()
+	s := Statistics{
+		Mean:        d.Mean(),
+		Variance:    d.Variance(),
+		StdDev:      d.StdDev(),
+		Median:      d.Median(),
+		Percentiles: map[int]int{},
+	}
+	if len(outcomes) > 0 {
+		s.Min = outcomes[0]
+		s.Max = outcomes[len(outcomes)-1]
+	}
+	for _, pc := range SummaryPercentiles {
+		s.Percentiles[pc] = d.Percentile(float64(pc))
+	}
+	return s
+}
+
+//Mean is the expected total.
+func (d Distribution) Mean() float64 {
+	mean := 0.0
+	for v, p := range d {
+		mean += float64(v) * p
+	}
+	return mean
+}
+
+//Variance is the expected squared distance of a total from the mean.
+func (d Distribution) Variance() float64 {
+	mean := d.Mean()
+	variance := 0.0
+	for v, p := range d {
+		variance += (float64(v) - mean) * (float64(v) - mean) * p
+	}
+	return variance
+}
+
+//StdDev is the standard deviation of the totals.
+func (d Distribution) StdDev() float64 {
+	return math.Sqrt(d.Variance())
+}
+
+//Median is the 50th percentile.
+func (d Distribution) Median() int {
+	return d.Percentile(50)
+}
+
+//Percentile is the lowest total which at least percentile percent of rolls are at or below.
+func (d Distribution) Percentile(percentile float64) int {
+	outcomes := d.Outcomes()
+	cumulative := 0.0
+	for _, v := range outcomes {
+		cumulative += d[v]
+		if cumulative >= percentile/100-percentileTolerance {
+			return v
+		}
+	}
+	if len(outcomes) == 0 {
+		return 0
+	}
+	return outcomes[len(outcomes)-1]
+}
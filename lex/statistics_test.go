@@ -0,0 +1,41 @@
+package lex
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func Test_statistics(t *testing.T) {
+	tests := map[string]Statistics{
+		"d6": {Mean: 3.5, Variance: 35. / 12, Min: 1, Max: 6, Median: 3,
+			Percentiles: map[int]int{5: 1, 10: 1, 25: 2, 75: 5, 90: 6, 95: 6}},
+		"2d6": {Mean: 7, Variance: 35. / 6, Min: 2, Max: 12, Median: 7,
+			Percentiles: map[int]int{5: 3, 10: 4, 25: 5, 75: 9, 90: 10, 95: 11}},
+		"4": {Mean: 4, Min: 4, Max: 4, Median: 4,
+			Percentiles: map[int]int{5: 4, 10: 4, 25: 4, 75: 4, 90: 4, 95: 4}},
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		d, err := ast.Distribution(Environment{})
+		if err != nil {
+			t.Fatal("ERROR", test, err)
+		}
+		actual := d.Statistics()
+		ok := math.Abs(actual.Mean-expected.Mean) < 1e-9 &&
+			math.Abs(actual.Variance-expected.Variance) < 1e-9 &&
+			math.Abs(actual.StdDev-math.Sqrt(expected.Variance)) < 1e-9 &&
+			actual.Min == expected.Min && actual.Max == expected.Max && actual.Median == expected.Median
+		for pc, v := range expected.Percentiles {
+			ok = ok && actual.Percentiles[pc] == v
+		}
+		if !ok {
+			t.Errorf("ERROR %v\texpected\t%v\tgot\t%v", test, expected, actual)
+			continue
+		}
+		t.Logf("OK %12v summarised as %v", test, actual)
+	}
+}
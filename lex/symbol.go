@@ -0,0 +1,190 @@
+package lex
+
+import (
+	"fmt"
+	"strings"
+)
+
+//symbolNames name the symbols in the order they are listed.
+var symbolNames = []string{"success", "failure", "advantage", "threat", "triumph", "despair", "light", "dark"}
+
+//narrativeDice are the Genesys narrative dice by name, `2dAbility+dDifficulty` rolls two ability dice and a
+//difficulty die. Their faces list a letter for each symbol shown: s success, f failure, a advantage, t threat,
+//T triumph, D despair, l light and d dark.
+var narrativeDice = map[string][]Symbols{
+	"Boost":       symbolFaces("", "", "s", "sa", "aa", "a"),
+	"Setback":     symbolFaces("", "", "f", "f", "t", "t"),
+	"Ability":     symbolFaces("", "s", "s", "ss", "a", "a", "sa", "aa"),
+	"Difficulty":  symbolFaces("", "f", "ff", "t", "t", "t", "tt", "ft"),
+	"Proficiency": symbolFaces("", "s", "s", "ss", "ss", "a", "sa", "sa", "sa", "aa", "aa", "T"),
+	"Challenge":   symbolFaces("", "f", "f", "ff", "ff", "t", "t", "ft", "ft", "tt", "tt", "D"),
+	"Force":       symbolFaces("d", "d", "d", "d", "d", "d", "dd", "l", "l", "ll", "ll", "ll"),
+}
+
+func symbolFaces(codes ...string) []Symbols {
+	faces := make([]Symbols, len(codes))
+	for i, code := range codes {
+		for _, c := range code {
+			*faces[i].symbol(c)++
+		}
+	}
+	return faces
+}
+
+//Symbols tallies the symbols shown by narrative dice.
+type Symbols struct {
+	Success   int
+	Failure   int
+	Advantage int
+	Threat    int
+	Triumph   int
+	Despair   int
+	Light     int
+	Dark      int
+}
+
+func (s *Symbols) symbol(code rune) *int {
+	switch code {
+	case 's':
+		return &s.Success
+	case 'f':
+		return &s.Failure
+	case 'a':
+		return &s.Advantage
+	case 't':
+		return &s.Threat
+	case 'T':
+		return &s.Triumph
+	case 'D':
+		return &s.Despair
+	case 'l':
+		return &s.Light
+	default:
+		return &s.Dark
+	}
+}
+
+//counts lists the count of each symbol in the order of symbolNames.
+func (s Symbols) counts() []int {
+	return []int{s.Success, s.Failure, s.Advantage, s.Threat, s.Triumph, s.Despair, s.Light, s.Dark}
+}
+
+//Cancel is the tally once each failure has cancelled a success and each threat an advantage.
+//Each triumph also counts as a success and each despair as a failure, the triumphs and despairs themselves remain.
+func (s Symbols) Cancel() Symbols {
+	c := Symbols{Triumph: s.Triumph, Despair: s.Despair, Light: s.Light, Dark: s.Dark}
+	if net := s.successes(); net > 0 {
+		c.Success = net
+	} else {
+		c.Failure = -net
+	}
+	if net := s.Advantage - s.Threat; net > 0 {
+		c.Advantage = net
+	} else {
+		c.Threat = -net
+	}
+	return c
+}
+
+//successes are the successes and triumphs less the failures and despairs, the total of a narrative die.
+func (s Symbols) successes() int {
+	return s.Success + s.Triumph - s.Failure - s.Despair
+}
+
+func (s Symbols) add(other Symbols) Symbols {
+	return Symbols{
+		Success:   s.Success + other.Success,
+		Failure:   s.Failure + other.Failure,
+		Advantage: s.Advantage + other.Advantage,
+		Threat:    s.Threat + other.Threat,
+		Triumph:   s.Triumph + other.Triumph,
+		Despair:   s.Despair + other.Despair,
+		Light:     s.Light + other.Light,
+		Dark:      s.Dark + other.Dark,
+	}
+}
+
+func (s Symbols) String() string {
+	var counts []string
+	for i, count := range s.counts() {
+		if count != 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, symbolNames[i]))
+		}
+	}
+	if len(counts) == 0 {
+		return "blank"
+	}
+	return strings.Join(counts, " ")
+}
+
+//face lists each symbol of a die's face, such as `success+advantage`.
+func (s Symbols) face() string {
+	var symbols []string
+	for i, count := range s.counts() {
+		for j := 0; j < count; j++ {
+			symbols = append(symbols, symbolNames[i])
+		}
+	}
+	if len(symbols) == 0 {
+		return "blank"
+	}
+	return strings.Join(symbols, "+")
+}
+
+//netSuccesses are the totals of the faces of a narrative die.
+func netSuccesses(faces []Symbols) []int {
+	totals := make([]int, len(faces))
+	for i, f := range faces {
+		totals[i] = f.successes()
+	}
+	return totals
+}
+
+//narrative is true when the node rolls narrative dice, or keeps or drops some of them.
+func (n *node) narrative() bool {
+	source := n
+	for source != nil && source.isDiceModifier() {
+		source = source.operand1
+	}
+	return source != nil && source.symbols != nil
+}
+
+//tally counts the symbols of the narrative dice rolled and kept by the node and the operands it adds up.
+//It is false when the node rolled no narrative dice.
+func (n *rolled) tally() (Symbols, bool) {
+	var s Symbols
+	if len(n.dice) > 0 {
+		if !n.narrative() {
+			return s, false
+		}
+		for _, i := range n.counted() {
+			s = s.add(n.dice[i].Symbols)
+		}
+		return s, true
+	}
+	narrative := false
+	var members []*rolled
+	switch {
+	case n.kind == NodeTypeInfixOperator && n.operator == "+":
+		members = []*rolled{n.operand1, n.operand2}
+	case n.kind == NodeTypeGroup && n.operator == "":
+		members = n.operands
+	}
+	for _, o := range members {
+		if t, ok := o.tally(); ok {
+			s = s.add(t)
+			narrative = true
+		}
+	}
+	return s, narrative
+}
+
+//planOfSymbols plans the faces of the narrative dice rolled by the node and their cancelled tally.
+func (n *rolled) planOfSymbols() string {
+	faces := make([]string, len(n.dice))
+	for i, d := range n.dice {
+		faces[i] = d.Symbols.face()
+	}
+	s, _ := n.tally()
+	return fmt.Sprintf("[%s] %v", strings.Join(faces, " "), s.Cancel())
+}
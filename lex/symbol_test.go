@@ -0,0 +1,89 @@
+package lex
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_cancel(t *testing.T) {
+	tests := map[string]struct {
+		s        Symbols
+		expected string
+	}{
+		"blank":                  {s: Symbols{}, expected: "blank"},
+		"success":                {s: Symbols{Success: 3, Failure: 1}, expected: "2 success"},
+		"failure":                {s: Symbols{Success: 1, Failure: 2, Advantage: 2, Threat: 1}, expected: "1 failure 1 advantage"},
+		"triumph":                {s: Symbols{Failure: 1, Triumph: 1}, expected: "1 triumph"},
+		"despair":                {s: Symbols{Success: 2, Despair: 1, Threat: 2}, expected: "1 success 2 threat 1 despair"},
+		"force is not cancelled": {s: Symbols{Light: 2, Dark: 1}, expected: "2 light 1 dark"},
+	}
+	for test, expected := range tests {
+		if s := expected.s.Cancel().String(); s != expected.expected {
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%s", test, expected.expected, s)
+		}
+	}
+}
+
+func Test_narrative_dice(t *testing.T) {
+	tests := map[string]struct {
+		min, max int
+	}{
+		"2dAbility+dProficiency+2dDifficulty": {min: -4, max: 6},
+		"3dAbilitykh2+dBoost":                 {min: 0, max: 5},
+		"dChallenge+dSetback":                 {min: -3, max: 0},
+		"dForce":                              {min: 0, max: 0},
+		"(dAbility,dSetback)":                 {min: -1, max: 2},
+	}
+	r := rand.New(rand.NewSource(11))
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			e, err := ast.Evaluate(r, Environment{})
+			if err != nil {
+				t.Fatal("ERROR", test, err)
+			}
+			v, result := e.Total(), e.Result()
+			if v < expected.min || v > expected.max {
+				t.Fatalf("ERROR %v\texpected\t[%d,%d]\tgot\t%d", test, expected.min, expected.max, v)
+			}
+			if result.Symbols == nil {
+				t.Fatalf("ERROR %v has no symbols", test)
+			}
+			if net := result.Symbols.Success - result.Symbols.Failure; net != v {
+				t.Fatalf("ERROR %v\texpected\t%d net successes\tgot\t%v", test, v, result.Symbols)
+			}
+			if i == 0 {
+				t.Logf("OK %36v planned as %v", test, e.Plan())
+			}
+		}
+	}
+}
+
+func Test_narrative_dice_errors(t *testing.T) {
+	tests := map[string]string{
+		"2dAbility!":   "((2dAbility)!) - can't explode narrative dice",
+		"3dBoostr0":    "((3dBoost)r0) - can't reroll narrative dice",
+		"dForcew":      "((1dForce)w) - can't wild roll narrative dice",
+		"2dAbility#>0": "((2dAbility)#>0) - can't count successes of narrative dice",
+	}
+	for test, expected := range tests {
+		ast, err := NewParser(strings.NewReader(test)).Parse()
+		if err == nil {
+			_, err = ast.Evaluate(rand.New(rand.NewSource(11)), Environment{})
+		}
+		if err == nil || err.Error() != expected {
+			t.Errorf("ERROR %v\texpected\t%s\tgot\t%v", test, expected, err)
+		}
+	}
+	if err := (NamedDice{}).Define("Boost", []int{1}); err == nil || err.Error() != "dBoost is a builtin die" {
+		t.Error("ERROR Boost expected builtin die error got", err)
+	}
+	if _, err := NewParser(strings.NewReader("2dAbility")).Parse(); err != nil {
+		t.Error("ERROR", err)
+	}
+}
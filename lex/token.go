@@ -5,6 +5,8 @@ import "fmt"
 type Token struct {
 	Kind  TokenType
 	Value string
+	//Offset of the token's first byte in the expression.
+	Offset int
 }
 
 type TokenType byte
@@ -17,6 +19,13 @@ const (
 	TokenInfixOperator
 	TokenOpenParen
 	TokenCloseParen
+	TokenSeparator
+	//TokenComparison is a comparator following an operand, checking one total against another as in `d20+5 >= 15`.
+	TokenComparison
+	//TokenVariable is the name of a variable, without its `@`.
+	TokenVariable
+	//TokenIdentifier names a macro or function.
+	TokenIdentifier
 	TokenError
 	TokenEndOfStream
 )
@@ -38,6 +47,14 @@ func (t TokenType) String() string {
 		s = "op"
 	case TokenCloseParen:
 		s = "cp"
+	case TokenSeparator:
+		s = "sep"
+	case TokenComparison:
+		s = "cmp"
+	case TokenVariable:
+		s = "var"
+	case TokenIdentifier:
+		s = "id"
 	case TokenError:
 		s = "err"
 	case TokenEndOfStream:
@@ -0,0 +1,26 @@
+package lex
+
+import "fmt"
+
+//Variables are the values of the `@` variables of an expression, such as the `str_mod` of `d20+@str_mod`.
+type Variables map[string]int
+
+//evalVariable looks up the value of the variable in the environment.
+func (n *rolled) evalVariable() (int, []int, error) {
+	v, ok := n.env.Variables[n.name]
+	if !ok {
+		return 0, []int{}, fmt.Errorf("unbound variable @%s", n.name)
+	}
+	n.v = v
+	n.vs = []int{v}
+	return n.v, n.vs, nil
+}
+
+//variableDistribution is the single value of the variable in the environment.
+func (n *node) variableDistribution(env Environment) (Distribution, error) {
+	v, ok := env.Variables[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unbound variable @%s", n.name)
+	}
+	return Distribution{v: 1}, nil
+}
@@ -2,29 +2,57 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/dan-frohlich/dice"
+	"github.com/dan-frohlich/dice/lex"
 )
 
+//shellIndent lines diagnostics up with the shell's replies.
+const shellIndent = "   "
+
+//statsCommand reports statistics of an expression instead of rolling it, e.g. `stats 3b4d6`.
+const statsCommand = "stats"
+
+//defCommand defines a macro, e.g. `def fireball = 8d6`, so `fireball = 24` stays a check.
+const defCommand = "def"
+
 func main() {
 
 	r := dice.NewRoller()
 
+	if len(os.Args) > 2 && os.Args[1] == statsCommand {
+		for _, expr := range os.Args[2:] {
+			stats, err := statistics(r, expr)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				diagnose(os.Stderr, "", expr, err)
+				os.Exit(1)
+			}
+			fmt.Println(expr, ":", stats)
+		}
+		return
+	}
+
 	if len(os.Args) > 1 {
 		for i, expr := range os.Args {
 			switch (i) {
 			case 0:
 				continue
 			default:
-				result, _, err := r.Roll(expr)
+				results, _, err := r.RollAll(expr)
 				if err != nil {
 					fmt.Fprintln(os.Stderr, err)
+					diagnose(os.Stderr, "", expr, err)
 					os.Exit(1)
 				}
-				fmt.Print(result, " ")
+				for _, result := range results {
+					fmt.Print(result, " ")
+				}
 			}
 		}
 		fmt.Println()
@@ -45,18 +73,69 @@ func main() {
 		// convert CRLF to LF
 		text = strings.Replace(text, "\n", "", -1)
 
-		result, plan, err := r.Roll(text)
+		if strings.HasPrefix(text, defCommand+" ") {
+			definition := strings.TrimPrefix(text, defCommand+" ")
+			if err := r.Define(definition); err != nil {
+				fmt.Println("<-", "ERROR", err)
+				continue
+			}
+			fmt.Println("<-", "defined", strings.TrimSpace(strings.SplitN(definition, "=", 2)[0]))
+			continue
+		}
+
+		if strings.HasPrefix(text, statsCommand+" ") {
+			stats, err := statistics(r, strings.TrimPrefix(text, statsCommand+" "))
+			if err != nil {
+				fmt.Println("<-", "ERROR", err)
+				diagnose(os.Stdout, shellIndent, strings.TrimPrefix(text, statsCommand+" "), err)
+				continue
+			}
+			fmt.Println("<-", stats)
+			continue
+		}
+
+		results, plans, err := r.RollAll(text)
 		if err != nil {
 			fmt.Println("<-", "ERROR", err)
+			diagnose(os.Stdout, shellIndent, text, err)
 			continue
 		}
-		fmt.Println("<-", result, ":", plan)
+		rolls := make([]string, len(results))
+		for i, result := range results {
+			rolls[i] = fmt.Sprint(result, " : ", plans[i])
+		}
+		fmt.Println("<-", strings.Join(rolls, " , "))
+	}
+
+}
+
+//diagnose prints the expression expr with a caret under the problem when err is a parse error, indenting each line.
+func diagnose(w io.Writer, indent, expr string, err error) {
+	var parseErr *lex.ParseError
+	if errors.As(err, &parseErr) {
+		for _, line := range strings.Split(parseErr.Render(expr), "\n") {
+			fmt.Fprintln(w, indent+line)
+		}
 	}
+}
 
+//statistics summarises the totals expr can roll, using the roller's macros, named dice and variables.
+func statistics(r dice.Roller, expr string) (lex.Statistics, error) {
+	e, err := r.Compile(expr)
+	if err != nil {
+		return lex.Statistics{}, err
+	}
+	d, err := e.Distribution()
+	if err != nil {
+		return lex.Statistics{}, err
+	}
+	return d.Statistics(), nil
 }
 
 func isExit(input string) bool {
-	return strings.HasPrefix(input, "exit") ||
-		strings.HasPrefix(input, "quit") ||
-		strings.HasPrefix(input, "q")
+	switch strings.TrimSpace(input) {
+	case "exit", "quit", "q":
+		return true
+	}
+	return false
 }
@@ -1,23 +1,59 @@
 package dice
 
 import (
+	"errors"
+	"fmt"
 	"github.com/dan-frohlich/dice/lex"
+	"math/big"
 	"math/rand"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
+//Roller rolls dice expressions. A Roller is safe for concurrent use by multiple goroutines, as are the Rollers
+//returned by WithVariables, WithDivision and WithLimits, which share its source, macros and named dice. Macros and
+//dice may be defined while other goroutines roll. The dice of concurrent rolls interleave in the sequence of the source.
+//The variables passed to WithVariables must not be modified while they are in use.
 type Roller interface {
 	Roll(input string) (result int, plan string, err error)
+	RollAll(input string) (results []int, plans []string, err error)
+	RollResult(input string) (result *lex.RollResult, err error)
+	Check(input string) (passed bool, margin int, plan string, err error)
+	WithVariables(vars map[string]int) Roller
+	Define(definition string) error
+	WithDivision(d lex.Division) Roller
+	RollFraction(input string) (result *big.Rat, plan string, err error)
+	DefineDie(name string, faces []int) error
+	RollSymbols(input string) (symbols lex.Symbols, plan string, err error)
+	Compile(input string) (*Expression, error)
+	WithLimits(limits lex.Limits) Roller
 }
 
 type roller struct {
-	r *rand.Rand
+	r        lex.Source
+	vars     lex.Variables
+	macros   lex.Macros
+	division lex.Division
+	dice     lex.NamedDice
+	limits   lex.Limits
+	//definitions guards macros and dice
+	definitions *sync.RWMutex
 }
 
 func NewSeededRoller(seed int64) Roller {
-	return roller{r: rand.New(rand.NewSource(seed))}
+	return NewRollerWithSource(rand.New(rand.NewSource(seed)))
+}
+
+//NewRollerWithSource is a Roller rolling its dice with the random numbers of source,
+//such as a CryptoSource, a ScriptedSource or a RecordingSource.
+func NewRollerWithSource(source lex.Source) Roller {
+	return roller{
+		r:           &lockedSource{source: source},
+		macros:      lex.Macros{},
+		dice:        lex.NamedDice{},
+		definitions: &sync.RWMutex{},
+	}
 }
 
 func NewRoller() Roller {
@@ -25,17 +61,155 @@ func NewRoller() Roller {
 }
 
 func (r roller) Roll(input string) (result int, plan string, err error) {
-	re := regexp.MustCompile(` |\t|\n`)
-	sanitized := re.ReplaceAllString(input, "")
-	p := lex.NewParser(strings.NewReader(sanitized))
-	var ast lex.AST
-	ast, err = p.Parse()
+	var e *lex.Evaluation
+	e, err = r.evaluate(input)
 
 	if err == nil {
-		result, _, err = ast.Evaluate(r.r)
-		if err == nil {
-			return int(result), ast.Plan(), nil
-		}
+		return e.Total(), e.Plan(), nil
 	}
 	return 0, "", err
 }
+
+//RollAll rolls each of the `,` delimited expressions in input independently. The Roller's limits bound all of them
+//together.
+func (r roller) RollAll(input string) (results []int, plans []string, err error) {
+	var asts []lex.AST
+	asts, err = r.parseAll(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(asts) == 0 {
+		return nil, nil, errors.New("nothing to roll")
+	}
+	evaluations, err := lex.EvaluateAll(asts, r.r, r.environment())
+	if err != nil {
+		return nil, nil, err
+	}
+	results = make([]int, len(asts))
+	plans = make([]string, len(asts))
+	for i, e := range evaluations {
+		results[i], plans[i] = e.Total(), e.Plan()
+	}
+	return results, plans, nil
+}
+
+//RollResult rolls the input and describes every node, operand and die of the roll.
+func (r roller) RollResult(input string) (result *lex.RollResult, err error) {
+	var e *lex.Evaluation
+	if e, err = r.evaluate(input); err != nil {
+		return nil, err
+	}
+	return e.Result(), nil
+}
+
+//Check rolls a check such as `d20+5 >= 15`, reporting whether it passed and by what margin.
+//The margin is how far the roll was past the closest passing total, negative when the check failed.
+func (r roller) Check(input string) (passed bool, margin int, plan string, err error) {
+	var e *lex.Evaluation
+	if e, err = r.evaluate(input); err != nil {
+		return false, 0, "", err
+	}
+	result := e.Result()
+	if result == nil || !result.Check {
+		return false, 0, "", fmt.Errorf("not a check: %s", input)
+	}
+	return result.Passed, result.Margin, e.Plan(), nil
+}
+
+//WithVariables is a Roller sharing this Roller's dice which resolves `@` variables, such as the `@str_mod` of
+//`d20+@str_mod`, from vars. Variables missing from vars fail to roll.
+func (r roller) WithVariables(vars map[string]int) Roller {
+	r.vars = vars
+	return r
+}
+
+//Define adds a macro such as `fireball = 8d6`, or a function such as `adv(x) = 1b(2d20)+x`, which later rolls
+//can use by name: `fireball+adv(5)`. Rollers returned by WithVariables share their macros.
+func (r roller) Define(definition string) error {
+	r.definitions.Lock()
+	defer r.definitions.Unlock()
+	return r.macros.DefineWithDice(definition, r.dice)
+}
+
+//WithDivision is a Roller sharing this Roller's dice and macros which rounds `/` as d does.
+//The default is lex.DivideTruncate, rounding toward zero.
+func (r roller) WithDivision(d lex.Division) Roller {
+	r.division = d
+	return r
+}
+
+//RollFraction rolls the input, keeping the fractions of the quotients `/` would round away: `7/2` is 7/2.
+func (r roller) RollFraction(input string) (result *big.Rat, plan string, err error) {
+	var e *lex.Evaluation
+	if e, err = r.evaluate(input); err != nil {
+		return nil, "", err
+	}
+	return e.Fraction(), e.Plan(), nil
+}
+
+//DefineDie adds a die with custom faces which later rolls can use by name: `DefineDie("Avg", []int{2, 3, 3, 4, 4, 5})`
+//rolls `2dAvg`. The name must start with a capital letter. Rollers returned by WithVariables share their dice.
+func (r roller) DefineDie(name string, faces []int) error {
+	r.definitions.Lock()
+	defer r.definitions.Unlock()
+	return r.dice.Define(name, faces)
+}
+
+//RollSymbols rolls narrative dice such as `2dAbility+dProficiency+2dDifficulty`, tallying their symbols once
+//failures and threats have cancelled successes and advantages.
+func (r roller) RollSymbols(input string) (symbols lex.Symbols, plan string, err error) {
+	var e *lex.Evaluation
+	if e, err = r.evaluate(input); err != nil {
+		return lex.Symbols{}, "", err
+	}
+	result := e.Result()
+	if result == nil || result.Symbols == nil {
+		return lex.Symbols{}, "", fmt.Errorf("no narrative dice: %s", input)
+	}
+	return *result.Symbols, e.Plan(), nil
+}
+
+//Compile parses the input once, with the Roller's macros, named dice, variables, division and limits, to be rolled
+//many times. Later definitions and variables don't change the Expression.
+func (r roller) Compile(input string) (*Expression, error) {
+	ast, err := r.parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{input: input, ast: ast, env: r.environment()}, nil
+}
+
+//WithLimits is a Roller sharing this Roller's dice and macros which fails with a *lex.LimitError to roll
+//expressions exceeding the limits, such as `999999999d999999999` rolling too many dice.
+func (r roller) WithLimits(limits lex.Limits) Roller {
+	r.limits = limits
+	return r
+}
+
+//parse parses the single expression input, expanding the Roller's macros and rolling its named dice.
+func (r roller) parse(input string) (lex.AST, error) {
+	r.definitions.RLock()
+	defer r.definitions.RUnlock()
+	return lex.NewParserWithLimits(strings.NewReader(input), r.macros, r.dice, r.limits).Parse()
+}
+
+//parseAll parses the `,` delimited expressions of input as parse does.
+func (r roller) parseAll(input string) ([]lex.AST, error) {
+	r.definitions.RLock()
+	defer r.definitions.RUnlock()
+	return lex.NewParserWithLimits(strings.NewReader(input), r.macros, r.dice, r.limits).ParseAll()
+}
+
+//evaluate parses the single expression input and evaluates it in the Roller's environment.
+func (r roller) evaluate(input string) (*lex.Evaluation, error) {
+	ast, err := r.parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return ast.Evaluate(r.r, r.environment())
+}
+
+//environment is the Roller's variables, division and limits.
+func (r roller) environment() lex.Environment {
+	return lex.Environment{Variables: r.vars, Division: r.division, Limits: r.limits}
+}
@@ -1,7 +1,15 @@
 package dice
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/dan-frohlich/dice/lex"
 )
 
 func Test_can_add(t *testing.T) {
@@ -90,6 +98,205 @@ func Test_various(t *testing.T) {
 	}
 }
 
+func Test_roll_all(t *testing.T) {
+	tests := map[string][][]int{
+		"d6,d8":       {{1, 6}, {1, 8}},
+		"1+1, 3d6":    {{2, 2}, {3, 18}},
+		"d20+5,2d6+3": {{6, 25}, {5, 15}},
+	}
+
+	roller := NewRoller()
+
+	for test, expected := range tests {
+		actual, plans, err := roller.RollAll(test)
+		if err != nil {
+			t.Error("ERROR", test, "error:", err)
+			continue
+		}
+		if len(actual) != len(expected) || len(plans) != len(expected) {
+			t.Error("ERROR", test, "expected", len(expected), "results got", actual, plans)
+			continue
+		}
+		for i, minMax := range expected {
+			if actual[i] < minMax[0] || actual[i] > minMax[1] {
+				t.Error("ERROR", test, "expected result", i, "in", minMax, "got", actual[i])
+			}
+		}
+		t.Log("OK", test, "got", actual, plans)
+	}
+
+	for _, test := range []string{"", "d6,", "d6,,d8"} {
+		if actual, _, err := roller.RollAll(test); err == nil {
+			t.Error("ERROR", test, "expected", "error", "got", actual)
+		}
+	}
+}
+
+func Test_roll_result(t *testing.T) {
+	roller := NewRoller()
+	for i := 0; i < 100; i++ {
+		result, err := roller.RollResult("3d6+2")
+		if err != nil {
+			t.Fatal("ERROR", err)
+		}
+		dice := result.Operands[0].Dice
+		total := 2
+		for _, d := range dice {
+			total += d.Value
+		}
+		if len(dice) != 3 || total != result.Total {
+			t.Fatal("ERROR 3d6+2 expected 3 dice summing to", result.Total, "got", dice)
+		}
+	}
+	if _, err := roller.RollResult("3@7"); err == nil {
+		t.Error("ERROR 3@7 expected error")
+	}
+}
+
+func Test_check(t *testing.T) {
+	tests := map[string]struct {
+		passed bool
+		margin int
+	}{
+		"10 >= 7":               {passed: true, margin: 3},
+		"2+3 < 7":               {passed: true, margin: 1},
+		"5 > 5":                 {passed: false, margin: -1},
+		"4 = 5":                 {passed: false, margin: -1},
+		"3 >= 1 && 2 > 5":       {passed: false, margin: -4},
+		"3 >= 1 || 2 > 5":       {passed: true, margin: 2},
+		"d20+20 >= 21 && 1 = 1": {passed: true, margin: 0},
+		"10>=7":                 {passed: true, margin: 3},
+		"10>= 7":                {passed: true, margin: 3},
+		"10 >=7":                {passed: true, margin: 3},
+		"3>=1&&2>5":             {passed: false, margin: -4},
+		"(2d1) < 7":             {passed: true, margin: 4},
+	}
+	roller := NewRoller()
+	for test, expected := range tests {
+		passed, margin, plan, err := roller.Check(test)
+		if err != nil {
+			t.Error("ERROR", test, err)
+			continue
+		}
+		if passed != expected.passed || margin != expected.margin {
+			t.Error("ERROR", test, "expected", expected, "got", passed, margin, plan)
+			continue
+		}
+		t.Log("OK", test, plan)
+	}
+	scripted := NewRollerWithSource(NewScriptedSource(17, 12, 9))
+	if passed, margin, _, err := scripted.Check("d20>=15"); err != nil || !passed || margin != 2 {
+		t.Error("ERROR d20>=15 rolling 17 expected to pass by 2 got", passed, margin, err)
+	}
+	if passed, margin, _, err := scripted.Check("d20>=10 && d20>=10"); err != nil || passed || margin != -1 {
+		t.Error("ERROR d20>=10 && d20>=10 rolling 12 and 9 expected to fail by 1 got", passed, margin, err)
+	}
+	for _, test := range []string{"3d6", "8d10#>=7", "8d10>=7", "6d6 > 4", "2 && 3", "d20 >", "d20 >= 15 >= 2"} {
+		if _, _, _, err := roller.Check(test); err == nil {
+			t.Error("ERROR", test, "expected error")
+		}
+	}
+}
+
+func Test_variables(t *testing.T) {
+	roller := NewRoller()
+	sheet := roller.WithVariables(map[string]int{"str_mod": 3, "prof": 2})
+	for i := 0; i < 100; i++ {
+		result, plan, err := sheet.Roll("d20+@str_mod+@prof")
+		if err != nil {
+			t.Fatal("ERROR", err)
+		}
+		if result < 6 || result > 25 || !strings.Contains(plan, "@str_mod [3]") {
+			t.Fatal("ERROR d20+@str_mod+@prof expected result in [6,25] got", result, plan)
+		}
+	}
+	if _, _, err := sheet.Roll("d20+@dex_mod"); err == nil || err.Error() != "unbound variable @dex_mod" {
+		t.Error("ERROR d20+@dex_mod expected unbound variable error got", err)
+	}
+	if _, _, err := roller.Roll("d20+@str_mod"); err == nil {
+		t.Error("ERROR d20+@str_mod expected unbound variable error without variables")
+	}
+}
+
+func Test_macros(t *testing.T) {
+	roller := NewRoller()
+	for _, definition := range []string{"fireball = 8d6", "adv(x) = 1b(2d20)+x"} {
+		if err := roller.Define(definition); err != nil {
+			t.Fatal("ERROR", definition, err)
+		}
+	}
+	sheet := roller.WithVariables(map[string]int{"dex": 4})
+	for i := 0; i < 100; i++ {
+		result, plan, err := sheet.Roll("fireball+adv(@dex)")
+		if err != nil {
+			t.Fatal("ERROR", err)
+		}
+		if result < 13 || result > 72 {
+			t.Fatal("ERROR fireball+adv(@dex) expected result in [13,72] got", result, plan)
+		}
+	}
+	if err := roller.Define("d6 = 3"); err == nil {
+		t.Error("ERROR d6 = 3 expected error")
+	}
+	if _, _, err := NewRoller().Roll("fireball"); err == nil {
+		t.Error("ERROR fireball expected unknown macro error on a new roller")
+	}
+}
+
+func Test_named_dice(t *testing.T) {
+	roller := NewRoller()
+	if err := roller.DefineDie("Avg", []int{2, 3, 3, 4, 4, 5}); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	if err := roller.Define("volley = 3dAvg"); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	for i := 0; i < 100; i++ {
+		result, plan, err := roller.WithVariables(nil).Roll("volley+d{-1,0,0,1}")
+		if err != nil {
+			t.Fatal("ERROR", err)
+		}
+		if result < 5 || result > 16 {
+			t.Fatal("ERROR volley+d{-1,0,0,1} expected result in [5,16] got", result, plan)
+		}
+	}
+	if _, _, err := NewRoller().Roll("2dAvg"); err == nil {
+		t.Error("ERROR 2dAvg expected unknown die error on a new roller")
+	}
+}
+
+func Test_symbols(t *testing.T) {
+	roller := NewRoller()
+	for i := 0; i < 100; i++ {
+		symbols, plan, err := roller.RollSymbols("2dAbility+dProficiency+2dDifficulty")
+		if err != nil {
+			t.Fatal("ERROR", err)
+		}
+		if symbols.Success > 0 && symbols.Failure > 0 || symbols.Advantage > 0 && symbols.Threat > 0 {
+			t.Fatal("ERROR expected cancelled symbols got", symbols, plan)
+		}
+	}
+	if _, _, err := roller.RollSymbols("2d6"); err == nil || err.Error() != "no narrative dice: 2d6" {
+		t.Error("ERROR 2d6 expected no narrative dice error got", err)
+	}
+}
+
+func Test_division(t *testing.T) {
+	roller := NewRoller()
+	if result, _, err := roller.WithDivision(lex.DivideDown).Roll("-7/2"); err != nil || result != -4 {
+		t.Error("ERROR -7/2 rounding down expected -4 got", result, err)
+	}
+	if result, _, err := roller.WithDivision(lex.DivideUp).Roll("7/2"); err != nil || result != 4 {
+		t.Error("ERROR 7/2 rounding up expected 4 got", result, err)
+	}
+	if result, _, err := roller.Roll("7/2"); err != nil || result != 3 {
+		t.Error("ERROR 7/2 truncating expected 3 got", result, err)
+	}
+	if result, _, err := roller.RollFraction("7/2+1/3"); err != nil || result.String() != "23/6" {
+		t.Error("ERROR 7/2+1/3 expected 23/6 got", result, err)
+	}
+}
+
 func Test_various_neg(t *testing.T) {
 	tests := []string{
 		"7^3", // parses, but disallowed in eval.
@@ -109,3 +316,141 @@ func Test_various_neg(t *testing.T) {
 	}
 
 }
+
+func Test_concurrent_rolls(t *testing.T) {
+	roller := NewSeededRoller(11)
+	if err := roller.Define("fireball = 8d6"); err != nil {
+		t.Fatal("ERROR", err)
+	}
+	sheet := roller.WithVariables(map[string]int{"dex": 3})
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if result, plan, err := sheet.Roll("fireball+d20+@dex"); err != nil || result < 12 || result > 71 {
+					errs <- fmt.Errorf("fireball+d20+@dex rolled %d %s %v", result, plan, err)
+					return
+				}
+				if _, _, err := roller.RollAll("4d6kh3,2dAbility+dDifficulty"); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := roller.RollResult("3b4d6"); err != nil {
+					errs <- err
+					return
+				}
+				if i%10 == 0 {
+					if err := roller.Define(fmt.Sprintf("m%d_%d = d%d", g, i, i+2)); err != nil {
+						errs <- err
+						return
+					}
+					if err := roller.DefineDie(fmt.Sprintf("D%d_%d", g, i), []int{1, 2, i}); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error("ERROR", err)
+	}
+}
+
+func Test_limits(t *testing.T) {
+	roller := NewSeededRoller(11).WithLimits(lex.Limits{Dice: 100, Sides: 100, Length: 20, Depth: 6, Time: time.Second})
+	tests := map[string]lex.Limit{
+		"999999999d999999999":    lex.LimitSides,
+		"200d6":                  lex.LimitDice,
+		"1+1+1+1+1+1+1+1+1+1+1":  lex.LimitLength,
+		"1b(d6,d8,d10,d12,d20)!": lex.LimitLength,
+	}
+	var limitErr *lex.LimitError
+	for test, expected := range tests {
+		_, _, err := roller.Roll(test)
+		if !errors.As(err, &limitErr) || limitErr.Limit != expected {
+			t.Errorf("ERROR %v\texpected\tlimit %v\tgot\t%v", test, expected, err)
+		}
+	}
+	if err := roller.Define("deep = ((1+1)+1)+1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := roller.Roll("deep+deep+deep+deep"); err == nil {
+		t.Error("ERROR expected the expanded macros to nest too deep")
+	}
+	if result, _, err := roller.Roll("4d6kh3"); err != nil || result < 3 || result > 18 {
+		t.Error("ERROR 4d6kh3 expected [3,18] got", result, err)
+	}
+	if _, _, err := roller.RollAll("60d6,60d6"); !errors.As(err, &limitErr) || limitErr.Limit != lex.LimitDice {
+		t.Error("ERROR expected 60d6,60d6 to roll too many dice together got", err)
+	}
+	if results, _, err := roller.RollAll("50d6,50d6"); err != nil || len(results) != 2 {
+		t.Error("ERROR expected 50d6,50d6 within the dice limit got", results, err)
+	}
+	e, err := Compile("200d6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := e.WithLimits(lex.Limits{Dice: 100}).Roll(rand.New(rand.NewSource(11))); err == nil {
+		t.Error("ERROR expected 200d6 to roll too many dice")
+	}
+	if _, _, err := NewRoller().Roll("9223372036854775807d1"); !errors.As(err, &limitErr) {
+		t.Error("ERROR expected the default roller to limit the dice rolled got", err)
+	}
+	slow, err := Compile("20d20d20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = slow.WithLimits(lex.Limits{Dice: 1000, Sides: 1000, Time: 10 * time.Millisecond}).Distribution()
+	if !errors.As(err, &limitErr) || limitErr.Limit != lex.LimitTime {
+		t.Error("ERROR expected the distribution of 20d20d20 to run out of time got", err)
+	}
+}
+
+func Test_overflow(t *testing.T) {
+	roller := NewSeededRoller(11)
+	for _, test := range []string{"99999999999*99999999999", "9223372036854775807+d6", "99999999999999999999"} {
+		if result, _, err := roller.Roll(test); !errors.Is(err, lex.ErrOverflow) {
+			t.Errorf("ERROR %v\texpected\tinteger overflow\tgot\t%d %v", test, result, err)
+		}
+	}
+	if _, err := Distribution("99999999999*99999999999"); !errors.Is(err, lex.ErrOverflow) {
+		t.Error("ERROR expected the distribution to overflow got", err)
+	}
+}
+
+func Test_parse_error(t *testing.T) {
+	roller := NewSeededRoller(11)
+	if err := roller.Define("hit(bonus) = d20 + bonus"); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		category lex.ErrorCategory
+		offset   int
+		token    string
+	}{
+		"2d6 + 7^3":     {category: lex.ErrorCharacter, offset: 7, token: "^"},
+		"2d6 + (1":      {category: lex.ErrorSyntax, offset: 6, token: "("},
+		"hit(1, 2) + 3": {category: lex.ErrorArguments, offset: 0, token: "hit"},
+		"2 + miss":      {category: lex.ErrorName, offset: 4, token: "miss"},
+		"2dAvg+1":       {category: lex.ErrorName, offset: 1, token: "dAvg"},
+		"2dAb+1":        {category: lex.ErrorName, offset: 1, token: "dAb"},
+		"dFoo":          {category: lex.ErrorName, offset: 0, token: "dFoo"},
+	}
+	for test, expected := range tests {
+		_, _, err := roller.Roll(test)
+		var parseErr *lex.ParseError
+		if !errors.As(err, &parseErr) || parseErr.Category != expected.category || parseErr.Offset != expected.offset ||
+			parseErr.Token != expected.token {
+			t.Errorf("ERROR %v\texpected\t%v %q @ %d\tgot\t%v", test, expected.category, expected.token, expected.offset, err)
+		}
+	}
+	if _, _, err := roller.Roll("1b(d6,d8"); err == nil || err.Error() != "parse error: unbalanced (" {
+		t.Error("ERROR expected the message to be unchanged got", err)
+	}
+}
@@ -0,0 +1,77 @@
+package dice
+
+import (
+	crand "crypto/rand"
+	"math/big"
+	"sync"
+
+	"github.com/dan-frohlich/dice/lex"
+)
+
+//lockedSource serializes the use of a source which isn't safe for concurrent use, such as a *rand.Rand.
+type lockedSource struct {
+	mu     sync.Mutex
+	source lex.Source
+}
+
+func (s *lockedSource) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Intn(n)
+}
+
+//CryptoSource rolls dice with the operating system's cryptographically secure random numbers.
+type CryptoSource struct{}
+
+//Intn returns a uniform number in [0,n). It panics when the operating system can't supply random numbers.
+func (CryptoSource) Intn(n int) int {
+	v, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(err)
+	}
+	return int(v.Int64())
+}
+
+//ScriptedSource rolls a scripted sequence of dice, for tests and demonstrations. Each die rolled shows the next of
+//the rolls, wrapped around its sides, so `NewScriptedSource(20, 3)` rolls `2d20` as 20 and 3.
+//The script starts over once every roll has been used.
+type ScriptedSource struct {
+	rolls []int
+	next  int
+}
+
+func NewScriptedSource(rolls ...int) *ScriptedSource {
+	return &ScriptedSource{rolls: rolls}
+}
+
+//Intn returns the next roll less one, wrapped into [0,n).
+func (s *ScriptedSource) Intn(n int) int {
+	if len(s.rolls) == 0 {
+		return 0
+	}
+	roll := s.rolls[s.next]
+	s.next = (s.next + 1) % len(s.rolls)
+	return ((roll-1)%n + n) % n
+}
+
+//RecordingSource records the dice rolled with its source, so a roll can be replayed with a ScriptedSource.
+type RecordingSource struct {
+	source lex.Source
+	rolls  []int
+}
+
+func NewRecordingSource(source lex.Source) *RecordingSource {
+	return &RecordingSource{source: source}
+}
+
+//Intn returns a number in [0,n) from the recorded source, recording it.
+func (s *RecordingSource) Intn(n int) int {
+	v := s.source.Intn(n)
+	s.rolls = append(s.rolls, v+1)
+	return v
+}
+
+//Rolls are the dice recorded so far, as NewScriptedSource takes them.
+func (s *RecordingSource) Rolls() []int {
+	return append([]int{}, s.rolls...)
+}
@@ -0,0 +1,54 @@
+package dice
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_scripted_source(t *testing.T) {
+	tests := map[string]struct {
+		rolls    []int
+		expected int
+		plan     string
+	}{
+		"2d20":     {rolls: []int{20, 3}, expected: 23, plan: "(2d20 [20 3])"},
+		"4d6kh3":   {rolls: []int{6, 1, 4, 4}, expected: 14, plan: "((4d6 [6 1 4 4])kh3 [4 4 6] dropped [1])"},
+		"3d6":      {rolls: []int{5}, expected: 15, plan: "(3d6 [5 5 5])"},
+		"d6":       {rolls: []int{8}, expected: 2, plan: "(1d6 [2])"},
+		"2d{1,3}":  {rolls: []int{2, 1}, expected: 4, plan: "(2d{1,3} [3 1])"},
+		"d6!":      {rolls: []int{6, 6, 2}, expected: 14, plan: "((1d6 [6])! [6 6 2])"},
+		"2dFkh1+1": {rolls: []int{3, 1}, expected: 2, plan: "(((2dF [1 -1])kh1 [1] dropped [-1])+1 [2])"},
+		"2d8w":     {rolls: []int{3, 8, 2, 5}, expected: 10, plan: "((2d8 [3 8])w trait [3] trait [8 2] wild [5] success 1 raise)"},
+	}
+	for test, expected := range tests {
+		roller := NewRollerWithSource(NewScriptedSource(expected.rolls...))
+		result, plan, err := roller.Roll(test)
+		if err != nil || result != expected.expected || plan != expected.plan {
+			t.Errorf("ERROR %v\texpected\t%d %s\tgot\t%d %s %v", test, expected.expected, expected.plan, result, plan, err)
+			continue
+		}
+		t.Log("OK", test, "rolled", result, plan)
+	}
+}
+
+func Test_recording_source(t *testing.T) {
+	recording := NewRecordingSource(rand.New(rand.NewSource(7)))
+	_, plan, err := NewRollerWithSource(recording).Roll("4d6kh3+d20!")
+	if err != nil {
+		t.Fatal("ERROR", err)
+	}
+	_, replayed, err := NewRollerWithSource(NewScriptedSource(recording.Rolls()...)).Roll("4d6kh3+d20!")
+	if err != nil || replayed != plan {
+		t.Error("ERROR expected replay", plan, "got", replayed, err)
+	}
+}
+
+func Test_crypto_source(t *testing.T) {
+	roller := NewRollerWithSource(CryptoSource{})
+	for i := 0; i < 100; i++ {
+		result, plan, err := roller.Roll("3d6")
+		if err != nil || result < 3 || result > 18 {
+			t.Fatal("ERROR 3d6 expected result in [3,18] got", result, plan, err)
+		}
+	}
+}